@@ -3,6 +3,7 @@ package main
 import (
 	"io"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/jroimartin/gocui"
 	"github.com/pkg/errors"
@@ -13,7 +14,8 @@ type GocuiHandler func(*gocui.Gui, *gocui.View) error
 
 // Binding describes a binding.
 type Binding struct {
-	Key     gocui.Key
+	// Key is either a gocui.Key or a rune.
+	Key     interface{}
 	Mod     gocui.Modifier
 	Handler GocuiHandler
 }
@@ -152,3 +154,61 @@ func GetLineHandler(cb func(int, string) error) GocuiHandler {
 		return cb(cy, line)
 	}
 }
+
+// wrappedLinesCount returns a number of view lines
+// a single buffer line occupies.
+func wrappedLinesCount(v *gocui.View, line string) int {
+	maxX, _ := v.Size()
+	if !v.Wrap || maxX <= 0 {
+		return 1
+	}
+	if n := utf8.RuneCountInString(line); n >= maxX {
+		return n/maxX + 1
+	}
+	return 1
+}
+
+// viewLinesCount returns a number of view lines
+// the given buffer lines occupy.
+func viewLinesCount(v *gocui.View, lines []string) int {
+	count := 0
+	for _, line := range lines {
+		count += wrappedLinesCount(v, line)
+	}
+	return count
+}
+
+// bufferLineIdx returns an index of the line in the view's buffer
+// at the current cursor position. Wrapped lines are taken into account.
+func bufferLineIdx(v *gocui.View) int {
+	_, oy := v.Origin()
+	_, cy := v.Cursor()
+	y := oy + cy
+
+	for i, line := range v.BufferLines() {
+		wrapped := wrappedLinesCount(v, line)
+		if y < wrapped {
+			return i
+		}
+		y -= wrapped
+	}
+
+	return -1
+}
+
+// CursorUpOrLoadHandler moves cursor one line up like CursorUpHandler.
+// If the cursor is already at the top of the view, it calls the load callback.
+func CursorUpOrLoadHandler(load func()) GocuiHandler {
+	return func(g *gocui.Gui, v *gocui.View) error {
+		if v == nil {
+			return nil
+		}
+		_, oy := v.Origin()
+		_, cy := v.Cursor()
+		if oy == 0 && cy == 0 {
+			load()
+			return nil
+		}
+		return CursorUpHandler(g, v)
+	}
+}
@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
+	"encoding/hex"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"go.uber.org/zap"
 
@@ -28,28 +32,62 @@ func chatToString(c *protocol.Chat) string {
 			return fmt.Sprintf("@%s", c.ID)
 		}
 		return fmt.Sprintf("@%s %#x", alias, crypto.FromECDSAPub(pk)[:8])
+	case protocol.ChatTypePrivateGroupChat:
+		return fmt.Sprintf("*%s (%d members)", c.Name, len(c.Members))
 	default:
 		return c.Name
 	}
 }
 
+// isPendingInvitation returns true if the given member was invited
+// to a private group chat but has not joined it yet.
+func isPendingInvitation(c *protocol.Chat, member string) bool {
+	if c.ChatType != protocol.ChatTypePrivateGroupChat {
+		return false
+	}
+	for _, m := range c.Members {
+		if m.ID == member {
+			return !m.Joined
+		}
+	}
+	return false
+}
+
 // ChatsViewController manages chats view.
 type ChatsViewController struct {
 	*ViewController
-	messenger *protocol.Messenger
-	chats     []*protocol.Chat
-	logger    *zap.Logger
+	messenger      *protocol.Messenger
+	myPubkeyString string
+	chats          []*protocol.Chat
+	// gaps is a set of chat IDs which miss some history.
+	// It is accessed only from the main loop.
+	gaps map[string]bool
+	// mentions is a set of chat IDs with mentions which were not viewed.
+	// It is accessed only from the main loop.
+	mentions map[string]bool
+	// onUnread is called from the main loop with a number
+	// of unread messages in all chats after refreshing them.
+	onUnread func(unread int)
+	logger   *zap.Logger
 }
 
 // NewChatsViewController returns a new chat view controller.
-func NewChatsViewController(vm *ViewController, m *protocol.Messenger, logger *zap.Logger) *ChatsViewController {
+func NewChatsViewController(vm *ViewController, id Identity, m *protocol.Messenger, logger *zap.Logger) *ChatsViewController {
 	return &ChatsViewController{
 		ViewController: vm,
 		messenger:      m,
+		myPubkeyString: "0x" + hex.EncodeToString(crypto.FromECDSAPub(&id.PublicKey)),
+		onUnread:       func(int) {},
 		logger:         logger.With(zap.Namespace("ChatsViewController")),
 	}
 }
 
+// OnUnreadChanged sets a callback called from the main loop with a number
+// of unread messages in all chats every time the chats are refreshed.
+func (c *ChatsViewController) OnUnreadChanged(fn func(unread int)) {
+	c.onUnread = fn
+}
+
 // LoadAndRefresh loads chats from the storage and refreshes the view.
 func (c *ChatsViewController) LoadAndRefresh() error {
 	if err := c.load(); err != nil {
@@ -59,6 +97,19 @@ func (c *ChatsViewController) LoadAndRefresh() error {
 	return nil
 }
 
+// SetChats replaces the listed chats with the given ones,
+// e.g. returned by the messenger after an update, and refreshes the view.
+func (c *ChatsViewController) SetChats(chats []*protocol.Chat) {
+	c.logger.Info("set chats", zap.Int("count", len(chats)))
+	c.chats = append(chats, newMentionsChat())
+	c.refresh()
+}
+
+// Chats returns the listed chats.
+func (c *ChatsViewController) Chats() []*protocol.Chat {
+	return c.chats
+}
+
 // ChatByIdx allows to retrieve a chat for a given index.
 func (c *ChatsViewController) ChatByIdx(idx int) (*protocol.Chat, bool) {
 	if idx > -1 && idx < len(c.chats) {
@@ -67,6 +118,31 @@ func (c *ChatsViewController) ChatByIdx(idx int) (*protocol.Chat, bool) {
 	return nil, false
 }
 
+// FindChat looks up a chat by its name, public key
+// or position in the list, starting from 1.
+func (c *ChatsViewController) FindChat(query string) (*protocol.Chat, bool) {
+	name := strings.TrimPrefix(query, "#")
+	for _, chat := range c.chats {
+		if chat.Name == name || chat.ID == query {
+			return chat, true
+		}
+	}
+
+	if publicKey, err := publicKeyArgToString(query); err == nil {
+		for _, chat := range c.chats {
+			if chat.ID == publicKey {
+				return chat, true
+			}
+		}
+	}
+
+	if idx, err := strconv.Atoi(query); err == nil {
+		return c.ChatByIdx(idx - 1)
+	}
+
+	return nil, false
+}
+
 // Add adds a new chat to the list.
 func (c *ChatsViewController) Add(chat protocol.Chat) error {
 	if err := c.messenger.SaveChat(&chat); err != nil {
@@ -75,33 +151,149 @@ func (c *ChatsViewController) Add(chat protocol.Chat) error {
 	return c.LoadAndRefresh()
 }
 
-// Remove removes a chat from the list.
-func (c *ChatsViewController) Remove(chat protocol.Chat) error {
+// Remove removes a chat from the list and stops listening to its messages.
+// If purge is true, all messages of the chat are removed from the storage.
+func (c *ChatsViewController) Remove(chat protocol.Chat, purge bool) error {
+	if isVirtualChat(&chat) {
+		return fmt.Errorf("the %s chat can't be removed", chat.Name)
+	}
+	if err := c.messenger.Leave(chat); err != nil {
+		return err
+	}
+	if purge {
+		if err := c.messenger.DeleteMessagesByChatID(chat.ID); err != nil {
+			return err
+		}
+	}
 	if err := c.messenger.DeleteChat(chat.ID); err != nil {
 		return err
 	}
 	return c.LoadAndRefresh()
 }
 
+// CreateGroup creates a new private group chat with the given members.
+func (c *ChatsViewController) CreateGroup(ctx context.Context, name string, members []string) (*protocol.MessengerResponse, error) {
+	response, err := c.messenger.CreateGroupChatWithMembers(ctx, name, members)
+	return c.afterGroupUpdate(response, err)
+}
+
+// InviteToGroup adds new members to a private group chat.
+func (c *ChatsViewController) InviteToGroup(ctx context.Context, chatID string, members []string) (*protocol.MessengerResponse, error) {
+	response, err := c.messenger.AddMembersToGroupChat(ctx, chatID, members)
+	return c.afterGroupUpdate(response, err)
+}
+
+// KickFromGroup removes a member from a private group chat.
+func (c *ChatsViewController) KickFromGroup(ctx context.Context, chatID string, member string) (*protocol.MessengerResponse, error) {
+	response, err := c.messenger.RemoveMemberFromGroupChat(ctx, chatID, member)
+	return c.afterGroupUpdate(response, err)
+}
+
+// PromoteInGroup makes the given members admins of a private group chat.
+func (c *ChatsViewController) PromoteInGroup(ctx context.Context, chatID string, members []string) (*protocol.MessengerResponse, error) {
+	response, err := c.messenger.AddAdminsToGroupChat(ctx, chatID, members)
+	return c.afterGroupUpdate(response, err)
+}
+
+// AcceptGroupInvitation confirms joining a private group chat we were invited to.
+func (c *ChatsViewController) AcceptGroupInvitation(ctx context.Context, chatID string) (*protocol.MessengerResponse, error) {
+	response, err := c.messenger.ConfirmJoiningGroup(ctx, chatID)
+	return c.afterGroupUpdate(response, err)
+}
+
+// LeaveGroup leaves a private group chat.
+func (c *ChatsViewController) LeaveGroup(ctx context.Context, chatID string) (*protocol.MessengerResponse, error) {
+	response, err := c.messenger.LeaveGroupChat(ctx, chatID)
+	return c.afterGroupUpdate(response, err)
+}
+
+// afterGroupUpdate refreshes the view after a group chat
+// membership has been changed successfully.
+func (c *ChatsViewController) afterGroupUpdate(response *protocol.MessengerResponse, err error) (*protocol.MessengerResponse, error) {
+	if err != nil {
+		return nil, err
+	}
+	// Group chats are updated in the background
+	// so the list is reloaded on the main loop.
+	c.g.Update(func(*gocui.Gui) error {
+		if err := c.LoadAndRefresh(); err != nil {
+			c.logger.Error("failed to load and refresh chats", zap.Error(err))
+		}
+		return nil
+	})
+	return response, nil
+}
+
+// MarkGaps marks chats which miss some history.
+func (c *ChatsViewController) MarkGaps(chatIDs []string) {
+	gaps := make(map[string]bool, len(chatIDs))
+	for _, id := range chatIDs {
+		gaps[id] = true
+	}
+	c.g.Update(func(*gocui.Gui) error {
+		c.gaps = gaps
+		c.refresh()
+		return nil
+	})
+}
+
+// MarkMentions marks chats with mentions which were not viewed.
+func (c *ChatsViewController) MarkMentions(chatIDs []string) {
+	mentions := make(map[string]bool, len(chatIDs))
+	for _, id := range chatIDs {
+		mentions[id] = true
+	}
+	c.g.Update(func(*gocui.Gui) error {
+		c.mentions = mentions
+		c.refresh()
+		return nil
+	})
+}
+
 // load loads chats from the storage.
+// The virtual mentions chat is listed after them.
 func (c *ChatsViewController) load() error {
 	chats := c.messenger.Chats()
 	c.logger.Info("loaded chats", zap.Int("count", len(chats)))
-	c.chats = chats
+	c.chats = append(chats, newMentionsChat())
 	return nil
 }
 
 // refresh repaints the current list of chats.
 func (c *ChatsViewController) refresh() {
+	theme := c.vm.Theme()
 	c.g.Update(func(*gocui.Gui) error {
 		if err := c.Clear(); err != nil {
 			return err
 		}
+		unread := 0
 		for _, chat := range c.chats {
-			if _, err := fmt.Fprintln(c.ViewController, chatToString(chat)); err != nil {
+			line := chatToString(chat)
+			if isPendingInvitation(chat, c.myPubkeyString) {
+				line += " [invited]"
+			}
+			if c.gaps[chat.ID] {
+				line += " [gap]"
+			}
+			if c.mentions[chat.ID] {
+				line += " [mention]"
+			}
+
+			style := theme.ChatStyle(chat)
+			if chat.UnviewedMessagesCount > 0 {
+				line += fmt.Sprintf(" (%d)", chat.UnviewedMessagesCount)
+				style = append(style, theme.Unread...)
+				unread += int(chat.UnviewedMessagesCount)
+			}
+			if c.mentions[chat.ID] || (isVirtualChat(chat) && len(c.mentions) > 0) {
+				style = theme.Mention
+			}
+
+			if _, err := fmt.Fprintln(c.ViewController, styled(line, style)); err != nil {
 				return err
 			}
 		}
+		c.onUnread(unread)
 		return nil
 	})
 }
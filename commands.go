@@ -0,0 +1,390 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ArgType is a type of a command argument.
+// Arguments are validated and converted according to their types.
+type ArgType int
+
+// Types of command arguments.
+const (
+	// ArgString is any word.
+	ArgString ArgType = iota
+	// ArgText is the rest of the line taken verbatim.
+	// It must be the last argument.
+	ArgText
+	// ArgInt is an integer number.
+	ArgInt
+	// ArgDuration is a positive duration which can be given in days, e.g. "3d".
+	ArgDuration
+	// ArgPublicKey is a hex-encoded public key.
+	ArgPublicKey
+	// ArgChoice is one of the choices of the argument.
+	ArgChoice
+	// ArgChat is a reference to a chat resolved by the command.
+	ArgChat
+	// ArgContact is a reference to a contact resolved by the command.
+	ArgContact
+	// ArgMessage is a message ID or its unique prefix.
+	ArgMessage
+)
+
+// ArgSpec describes a command argument.
+type ArgSpec struct {
+	Name string
+	Type ArgType
+	// Choices are allowed values of ArgChoice arguments.
+	Choices []string
+	// Optional arguments can be omitted at the end of the command.
+	Optional bool
+	// Variadic arguments take all remaining words.
+	Variadic bool
+	// Help describes the argument in the /help output.
+	Help string
+	// Complete overrides completion of the argument based on its type.
+	Complete argCompleter
+}
+
+func (s ArgSpec) parse(value string) (interface{}, error) {
+	switch s.Type {
+	case ArgInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a number, got %q", s.Name, value)
+		}
+		return n, nil
+	case ArgDuration:
+		d, err := parseHistoryDuration(value)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%s must be a duration like 6h or 3d, got %q", s.Name, value)
+		}
+		return d, nil
+	case ArgPublicKey:
+		publicKey, err := publicKeyArgToString(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be a public key: %v", s.Name, err)
+		}
+		return publicKey, nil
+	case ArgChoice:
+		if !containsString(s.Choices, value) {
+			return nil, fmt.Errorf("%s must be %s, got %q", s.Name, strings.Join(s.Choices, " or "), value)
+		}
+		return value, nil
+	default:
+		return value, nil
+	}
+}
+
+func (s ArgSpec) usage() string {
+	name := "<" + s.Name + ">"
+	if s.Type == ArgChoice {
+		name = strings.Join(s.Choices, "|")
+	}
+	if s.Variadic {
+		name += "..."
+	}
+	if s.Optional {
+		name = "[" + name + "]"
+	}
+	return name
+}
+
+// Args are parsed arguments of a command.
+type Args struct {
+	values map[string][]interface{}
+}
+
+// Has returns true if the argument was given.
+func (a *Args) Has(name string) bool {
+	return len(a.values[name]) > 0
+}
+
+// String returns a value of a string-like argument.
+func (a *Args) String(name string) string {
+	if !a.Has(name) {
+		return ""
+	}
+	return a.values[name][0].(string)
+}
+
+// Strings returns values of a variadic string-like argument.
+func (a *Args) Strings(name string) []string {
+	values := make([]string, len(a.values[name]))
+	for i, v := range a.values[name] {
+		values[i] = v.(string)
+	}
+	return values
+}
+
+// Int returns a value of an ArgInt argument.
+func (a *Args) Int(name string) int64 {
+	if !a.Has(name) {
+		return 0
+	}
+	return a.values[name][0].(int64)
+}
+
+// Duration returns a value of an ArgDuration argument.
+func (a *Args) Duration(name string) time.Duration {
+	if !a.Has(name) {
+		return 0
+	}
+	return a.values[name][0].(time.Duration)
+}
+
+// Command is a command typed in the input view.
+// It either has subcommands or is run with its arguments.
+type Command struct {
+	// Name is a command name starting with "/"
+	// or a name of a subcommand.
+	Name    string
+	Summary string
+	// Usage overrides the usage generated from arguments.
+	Usage       string
+	Args        []ArgSpec
+	Subcommands []*Command
+	Run         func(args *Args) error
+}
+
+// Subcommand returns a subcommand with the given name.
+func (c *Command) Subcommand(name string) (*Command, bool) {
+	for _, sub := range c.Subcommands {
+		if sub.Name == name {
+			return sub, true
+		}
+	}
+	return nil, false
+}
+
+// usage returns a usage line of a command without subcommands.
+// prefix contains names of the parent commands.
+func (c *Command) usage(prefix string) string {
+	if c.Usage != "" {
+		return prefix + c.Usage
+	}
+	parts := []string{prefix + c.Name}
+	for _, arg := range c.Args {
+		parts = append(parts, arg.usage())
+	}
+	return strings.Join(parts, " ")
+}
+
+// helpLines returns usage lines and summaries of the command and its subcommands.
+func (c *Command) helpLines(prefix string) [][2]string {
+	if len(c.Subcommands) == 0 {
+		return [][2]string{{c.usage(prefix), c.Summary}}
+	}
+	var lines [][2]string
+	for _, sub := range c.Subcommands {
+		lines = append(lines, sub.helpLines(prefix+c.Name+" ")...)
+	}
+	return lines
+}
+
+// argsHelp returns descriptions of arguments of the command and its subcommands.
+func (c *Command) argsHelp() [][2]string {
+	var lines [][2]string
+	seen := make(map[string]bool)
+	var collect func(*Command)
+	collect = func(cmd *Command) {
+		for _, arg := range cmd.Args {
+			if arg.Help != "" && !seen[arg.Name] {
+				seen[arg.Name] = true
+				lines = append(lines, [2]string{"<" + arg.Name + ">", arg.Help})
+			}
+		}
+		for _, sub := range cmd.Subcommands {
+			collect(sub)
+		}
+	}
+	collect(c)
+	return lines
+}
+
+// commandUsageError is an error of command arguments.
+type commandUsageError struct {
+	err   error
+	usage []string
+}
+
+func (e *commandUsageError) Error() string {
+	return fmt.Sprintf("%v; usage: %s", e.err, strings.Join(e.usage, ", "))
+}
+
+// resolve finds the subcommand to run and parses its arguments.
+func (c *Command) resolve(tokens []argToken, raw string) (*Command, *Args, error) {
+	cmd, prefix := c, ""
+	for len(cmd.Subcommands) > 0 {
+		usage := cmd.helpLines(prefix)
+		usages := make([]string, len(usage))
+		for i, line := range usage {
+			usages[i] = line[0]
+		}
+		if len(tokens) == 0 {
+			return nil, nil, &commandUsageError{errors.New("subcommand is required"), usages}
+		}
+		sub, ok := cmd.Subcommand(tokens[0].text)
+		if !ok {
+			return nil, nil, &commandUsageError{fmt.Errorf("unknown subcommand %s", tokens[0].text), usages}
+		}
+		prefix += cmd.Name + " "
+		cmd, tokens = sub, tokens[1:]
+	}
+
+	args, err := parseArgs(cmd.Args, tokens, raw)
+	if err != nil {
+		return nil, nil, &commandUsageError{err, []string{cmd.usage(prefix)}}
+	}
+	return cmd, args, nil
+}
+
+// parseArgs validates and converts arguments according to their specs.
+func parseArgs(specs []ArgSpec, tokens []argToken, raw string) (*Args, error) {
+	args := &Args{values: make(map[string][]interface{})}
+
+	i := 0
+	for _, spec := range specs {
+		if spec.Type == ArgText {
+			if i < len(tokens) {
+				args.values[spec.Name] = []interface{}{strings.TrimSpace(raw[tokens[i].start:])}
+				i = len(tokens)
+			} else if !spec.Optional {
+				return nil, fmt.Errorf("%s is required", spec.Name)
+			}
+			break
+		}
+
+		if i >= len(tokens) {
+			if spec.Optional {
+				continue
+			}
+			return nil, fmt.Errorf("%s is required", spec.Name)
+		}
+
+		n := 1
+		if spec.Variadic {
+			n = len(tokens) - i
+		}
+		for ; n > 0; n-- {
+			value, err := spec.parse(tokens[i].text)
+			if err != nil {
+				return nil, err
+			}
+			args.values[spec.Name] = append(args.values[spec.Name], value)
+			i++
+		}
+	}
+
+	if i < len(tokens) {
+		return nil, fmt.Errorf("unexpected argument %s", tokens[i].text)
+	}
+	return args, nil
+}
+
+// argToken is a word of a command.
+// start is an offset of the word in the command line.
+type argToken struct {
+	text  string
+	start int
+}
+
+// splitArgs splits a command line into words like a shell does.
+// Words are separated with whitespace which can be
+// quoted with single or double quotes or escaped with a backslash.
+func splitArgs(line string) ([]argToken, error) {
+	var (
+		tokens  []argToken
+		current strings.Builder
+		start   = -1
+		quote   rune
+		escaped bool
+	)
+
+	for i, r := range line {
+		switch {
+		case escaped:
+			current.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+		case unicode.IsSpace(r):
+			if start != -1 {
+				tokens = append(tokens, argToken{current.String(), start})
+				current.Reset()
+				start = -1
+			}
+			continue
+		default:
+			current.WriteRune(r)
+		}
+		if start == -1 {
+			start = i
+		}
+	}
+
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if escaped {
+		return nil, errors.New("unterminated escape")
+	}
+	if start != -1 {
+		tokens = append(tokens, argToken{current.String(), start})
+	}
+	return tokens, nil
+}
+
+// formatHelp formats help of the given commands as aligned columns.
+func formatHelp(commands []*Command) string {
+	var lines [][2]string
+	for _, cmd := range commands {
+		lines = append(lines, cmd.helpLines("")...)
+	}
+	if len(commands) == 1 {
+		if args := commands[0].argsHelp(); len(args) > 0 {
+			lines = append(lines, [2]string{"", ""})
+			lines = append(lines, args...)
+		}
+	}
+
+	width := 0
+	for _, line := range lines {
+		if len(line[0]) > width {
+			width = len(line[0])
+		}
+	}
+
+	var b strings.Builder
+	for _, line := range lines {
+		fmt.Fprintf(&b, "%-*s  %s\n", width, line[0], line[1])
+	}
+	return strings.TrimRight(b.String(), "\n ")
+}
+
+// sortedCommands returns commands sorted by name.
+func sortedCommands(commands map[string]*Command) []*Command {
+	list := make([]*Command, 0, len(commands))
+	for _, cmd := range commands {
+		list = append(list, cmd)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
@@ -0,0 +1,415 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jroimartin/gocui"
+	"go.uber.org/zap"
+
+	"github.com/status-im/status-go/protocol"
+)
+
+// maxCompletionRows is a maximum number of candidates
+// displayed in the completions view at once.
+const maxCompletionRows = 8
+
+// completionCandidate is a text which can replace the completed word.
+type completionCandidate struct {
+	Text  string
+	Label string
+	// keys are matched against the completed word.
+	// If empty, the text is matched.
+	keys []string
+}
+
+func (c completionCandidate) matches(word string) bool {
+	word = strings.ToLower(word)
+	keys := c.keys
+	if len(keys) == 0 {
+		keys = []string{c.Text}
+	}
+	for _, k := range keys {
+		if strings.HasPrefix(strings.ToLower(k), word) {
+			return true
+		}
+	}
+	return false
+}
+
+// argCompleter returns candidates of a command argument.
+type argCompleter func(*Completer) []completionCandidate
+
+// completerOf returns a completer of the argument.
+// Unless the argument overrides it, it's based on the argument type.
+func completerOf(spec ArgSpec) argCompleter {
+	if spec.Complete != nil {
+		return spec.Complete
+	}
+	switch spec.Type {
+	case ArgChoice:
+		return completeWords(spec.Choices...)
+	case ArgDuration:
+		return completeWords("1h", "6h", "1d", "7d")
+	case ArgChat:
+		return completeChats
+	case ArgContact, ArgPublicKey:
+		return completeContacts
+	case ArgMessage:
+		return completeMessages
+	case ArgText:
+		return completeAliases
+	default:
+		return nil
+	}
+}
+
+// completeWords returns a completer of fixed words.
+func completeWords(words ...string) argCompleter {
+	return func(*Completer) []completionCandidate {
+		candidates := make([]completionCandidate, len(words))
+		for i, w := range words {
+			candidates[i] = completionCandidate{Text: w, Label: w}
+		}
+		return candidates
+	}
+}
+
+// completeAny returns a completer of candidates of all the given completers.
+func completeAny(completers ...argCompleter) argCompleter {
+	return func(c *Completer) []completionCandidate {
+		var candidates []completionCandidate
+		for _, complete := range completers {
+			candidates = append(candidates, complete(c)...)
+		}
+		return candidates
+	}
+}
+
+// completeCommands completes names of registered commands.
+func completeCommands(c *Completer) []completionCandidate {
+	commands := c.commands.Commands()
+	names := make([]string, len(commands))
+	for i, cmd := range commands {
+		names[i] = cmd.Name
+	}
+	return completeWords(names...)(c)
+}
+
+// completeChats completes names of chats or public keys of one-to-one chats.
+func completeChats(c *Completer) []completionCandidate {
+	var candidates []completionCandidate
+	for _, chat := range c.chats.Chats() {
+		if isVirtualChat(chat) {
+			continue
+		}
+		candidate := completionCandidate{Text: chat.Name, Label: chatToString(chat), keys: []string{chat.Name}}
+		if chat.ChatType == protocol.ChatTypeOneToOne {
+			candidate.Text = chat.ID
+			candidate.keys = []string{chat.ID, chatToString(chat)[1:]}
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates
+}
+
+// completeContacts completes public keys of contacts
+// and authors of messages of the active chat by their aliases.
+func completeContacts(c *Completer) []completionCandidate {
+	var candidates []completionCandidate
+	for _, author := range c.authors() {
+		label := author.Alias
+		if author.Name != "" {
+			label = fmt.Sprintf("%s (%s)", author.Alias, author.Name)
+		}
+		candidates = append(candidates, completionCandidate{
+			Text:  author.ID,
+			Label: fmt.Sprintf("%s %s", label, author.ID[:9]),
+			keys:  []string{author.Alias, author.Name, author.ID},
+		})
+	}
+	return candidates
+}
+
+// completeMessages completes IDs of messages of the active chat
+// starting with the most recent ones.
+func completeMessages(c *Completer) []completionCandidate {
+	messages := c.messages.Messages()
+	candidates := make([]completionCandidate, 0, len(messages))
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		candidates = append(candidates, completionCandidate{
+			Text:  m.ID,
+			Label: fmt.Sprintf("%s %s: %s", shortMessageID(m.ID), m.Alias, truncateText(formatContent(m), maxQuoteLength)),
+		})
+	}
+	return candidates
+}
+
+// completeAliases completes aliases of contacts and authors
+// of messages of the active chat in the text of messages.
+func completeAliases(c *Completer) []completionCandidate {
+	var candidates []completionCandidate
+	for _, author := range c.authors() {
+		candidates = append(candidates, completionCandidate{Text: author.Alias, Label: author.Alias})
+	}
+	return candidates
+}
+
+// Completer completes the word before the cursor of the input view
+// cycling through candidates displayed in the completions view.
+// It is accessed only from the main loop.
+type Completer struct {
+	*ViewController
+	commands *InputMultiplexer
+	chats    *ChatsViewController
+	contacts *ContactsViewController
+	messages *MessagesViewController
+	logger   *zap.Logger
+
+	candidates []completionCandidate
+	current    int
+	// inserted is a number of characters of the inserted candidate.
+	inserted int
+	// line is a text of the input line after inserting the candidate.
+	line string
+	// x is a position of the completed word in the input line.
+	x int
+}
+
+// NewCompleter returns a new completer of commands registered in the multiplexer.
+func NewCompleter(
+	vc *ViewController,
+	commands *InputMultiplexer,
+	chats *ChatsViewController,
+	contacts *ContactsViewController,
+	messages *MessagesViewController,
+	logger *zap.Logger,
+) *Completer {
+	return &Completer{
+		ViewController: vc,
+		commands:       commands,
+		chats:          chats,
+		contacts:       contacts,
+		messages:       messages,
+		logger:         logger.With(zap.Namespace("Completer")),
+	}
+}
+
+// Complete completes the word before the cursor of the input view.
+// If it's called again without editing the input in between,
+// the next candidate replaces the previous one.
+// It returns false if the input is empty so there is nothing to complete.
+func (c *Completer) Complete(v *gocui.View) (bool, error) {
+	ox, oy := v.Origin()
+	cx, cy := v.Cursor()
+	line, err := v.Line(cy)
+	if err != nil {
+		line = ""
+	}
+	x := ox + cx
+	runes := []rune(line)
+	if x > len(runes) {
+		x = len(runes)
+	}
+
+	if len(c.candidates) > 1 && line == c.line && x == c.x+c.inserted {
+		c.current = (c.current + 1) % len(c.candidates)
+		c.replace(v, c.inserted, c.candidates[c.current].Text)
+		return true, c.render()
+	}
+
+	if strings.TrimSpace(v.Buffer()) == "" {
+		return false, c.Reset()
+	}
+
+	start := x
+	for start > 0 && runes[start-1] != ' ' {
+		start--
+	}
+	word := string(runes[start:x])
+	args := strings.Fields(string(runes[:start]))
+	if tokens, err := splitArgs(string(runes[:start])); err == nil {
+		args = make([]string, len(tokens))
+		for i, t := range tokens {
+			args[i] = t.text
+		}
+	}
+	isCommand := oy+cy == 0 && strings.HasPrefix(line, "/")
+
+	var candidates []completionCandidate
+	for _, candidate := range c.candidatesFor(args, isCommand) {
+		if candidate.matches(word) {
+			candidates = append(candidates, candidate)
+		}
+	}
+	c.logger.Debug("completing", zap.String("word", word), zap.Int("candidates", len(candidates)))
+
+	switch len(candidates) {
+	case 0:
+		return true, c.Reset()
+	case 1:
+		c.replace(v, x-start, candidates[0].Text+" ")
+		return true, c.Reset()
+	}
+
+	if err := c.Reset(); err != nil {
+		return true, err
+	}
+	c.candidates = candidates
+	c.current = 0
+	c.x = start
+	c.replace(v, x-start, candidates[0].Text)
+	return true, c.render()
+}
+
+// candidatesFor returns candidates of a word following the given arguments.
+func (c *Completer) candidatesFor(args []string, isCommand bool) []completionCandidate {
+	if !isCommand {
+		return completeAliases(c)
+	}
+	if len(args) == 0 {
+		return completeCommands(c)
+	}
+
+	cmd, ok := c.commands.Command(args[0])
+	if !ok {
+		return nil
+	}
+	args = args[1:]
+	for len(cmd.Subcommands) > 0 {
+		if len(args) == 0 {
+			names := make([]string, len(cmd.Subcommands))
+			for i, sub := range cmd.Subcommands {
+				names[i] = sub.Name
+			}
+			return completeWords(names...)(c)
+		}
+		if cmd, ok = cmd.Subcommand(args[0]); !ok {
+			return nil
+		}
+		args = args[1:]
+	}
+
+	for i, spec := range cmd.Args {
+		if i == len(args) || spec.Variadic || spec.Type == ArgText {
+			if complete := completerOf(spec); complete != nil {
+				return complete(c)
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+// authors returns contacts and authors of messages of the active chat.
+func (c *Completer) authors() []*protocol.Contact {
+	var authors []*protocol.Contact
+	seen := make(map[string]bool)
+	for _, contact := range c.contacts.Contacts() {
+		if contact.Alias == "" || contact.IsBlocked() {
+			continue
+		}
+		seen[contact.ID] = true
+		authors = append(authors, contact)
+	}
+	messages := c.messages.Messages()
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		if seen[m.From] || m.Alias == "" || m.From == c.messages.myPubkeyString {
+			continue
+		}
+		seen[m.From] = true
+		authors = append(authors, &protocol.Contact{ID: m.From, Alias: m.Alias})
+	}
+	return authors
+}
+
+// replace replaces n characters before the cursor with the text.
+func (c *Completer) replace(v *gocui.View, n int, text string) {
+	for i := 0; i < n; i++ {
+		v.EditDelete(true)
+	}
+	for _, r := range text {
+		v.EditWrite(r)
+	}
+	c.inserted = utf8.RuneCountInString(text)
+
+	_, cy := v.Cursor()
+	c.line, _ = v.Line(cy)
+}
+
+// Reset hides candidates so that the next completion starts from scratch.
+func (c *Completer) Reset() error {
+	if c.candidates == nil {
+		return nil
+	}
+	c.candidates = nil
+	return c.vm.HideView(c.viewName)
+}
+
+// PopupBounds returns coordinates of the completions view
+// displayed above the completed word of the input view.
+func (c *Completer) PopupBounds(maxX, maxY int) (x0, y0, x1, y1 int) {
+	width := 0
+	for _, candidate := range c.candidates {
+		if n := utf8.RuneCountInString(candidate.Label); n > width {
+			width = n
+		}
+	}
+	height := len(c.candidates)
+	if height > maxCompletionRows {
+		height = maxCompletionRows
+	}
+
+	x0 = c.x
+	if x0+width+2 >= maxX {
+		x0 = maxX - width - 3
+	}
+	if x0 < 0 {
+		x0 = 0
+	}
+	return x0, maxY - 5 - height, x0 + width + 2, maxY - 4
+}
+
+func (c *Completer) render() error {
+	if err := c.vm.ShowView(c.viewName); err != nil {
+		return err
+	}
+	v, err := c.vm.RawView(c.viewName)
+	if err != nil {
+		return err
+	}
+
+	v.Clear()
+	for _, candidate := range c.candidates {
+		if _, err := fmt.Fprintln(v, candidate.Label); err != nil {
+			return err
+		}
+	}
+
+	// Keep the current candidate visible.
+	oy := 0
+	if c.current >= maxCompletionRows {
+		oy = c.current - maxCompletionRows + 1
+	}
+	if err := v.SetOrigin(0, oy); err != nil {
+		return err
+	}
+	return v.SetCursor(0, c.current-oy)
+}
+
+// completionEditor resets the completer when the input is edited.
+type completionEditor struct {
+	editor    gocui.Editor
+	completer *Completer
+}
+
+// Edit implements gocui.Editor.
+func (e *completionEditor) Edit(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+	if err := e.completer.Reset(); err != nil {
+		e.completer.logger.Error("failed to reset completion", zap.Error(err))
+	}
+	e.editor.Edit(v, key, ch, mod)
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/jroimartin/gocui"
+	"github.com/nsf/termbox-go"
+	"go.uber.org/zap"
+)
+
+// defaultEditor is used if neither $VISUAL nor $EDITOR is set.
+const defaultEditor = "vi"
+
+// Composer edits messages in an external editor.
+//
+// The editor takes over the terminal so the main loop
+// is blocked until it exits. Events which arrive
+// in the meantime are handled afterwards.
+type Composer struct {
+	g             *gocui.Gui
+	outputMode    gocui.OutputMode
+	messages      *MessagesViewController
+	notifications *NotificationViewController
+	send          func(text string) error
+	logger        *zap.Logger
+}
+
+// NewComposer returns a new composer. outputMode must be the mode
+// the gui was created with. send is called with the edited text.
+func NewComposer(
+	g *gocui.Gui,
+	outputMode gocui.OutputMode,
+	messages *MessagesViewController,
+	notifications *NotificationViewController,
+	send func(text string) error,
+	logger *zap.Logger,
+) *Composer {
+	return &Composer{
+		g:             g,
+		outputMode:    outputMode,
+		messages:      messages,
+		notifications: notifications,
+		send:          send,
+		logger:        logger.With(zap.Namespace("Composer")),
+	}
+}
+
+// Compose opens the editor with the text and the message
+// we reply to quoted above it. If the editor exits successfully,
+// the edited text is sent unless it's empty. Otherwise,
+// it's loaded into the input view.
+// It must be called from the main loop.
+func (c *Composer) Compose(v *gocui.View, text string) error {
+	var quote string
+	if replyTo := c.messages.ReplyingTo(); replyTo != nil {
+		quote = fmt.Sprintf("> %s: %s\n\n", replyTo.Alias, strings.Replace(formatContent(replyTo), "\n", "\n> ", -1))
+	}
+
+	c.g.Close()
+	edited, editErr := c.edit(quote + text)
+	if err := c.resume(); err != nil {
+		return err
+	}
+
+	// The quote is only a context and the reply refers to the message anyway.
+	edited = strings.TrimSpace(strings.TrimPrefix(edited, quote))
+
+	if editErr != nil {
+		c.notifications.Error("Editor", editErr.Error())
+		if edited == "" {
+			edited = text
+		}
+		return setInputText(v, edited)
+	}
+	if edited == "" {
+		return setInputText(v, text)
+	}
+	if err := setInputText(v, ""); err != nil {
+		return err
+	}
+	return c.send(edited)
+}
+
+// edit runs the editor on a temporary file with the text
+// and returns the edited text. If the editor fails,
+// the text is returned with the error if it can be read.
+func (c *Composer) edit(text string) (string, error) {
+	f, err := ioutil.TempFile("", "status-term-client-*.md")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(text)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = defaultEditor
+	}
+	// The editor might be given with arguments, e.g. "code --wait".
+	args := append(strings.Fields(editor), f.Name())
+
+	c.logger.Info("running editor", zap.Strings("args", args))
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	runErr := cmd.Run()
+
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return "", err
+	}
+	if runErr != nil {
+		return string(data), fmt.Errorf("%s failed: %v", args[0], runErr)
+	}
+	return string(data), nil
+}
+
+// resume takes the terminal back from the editor.
+// The main loop redraws all views after the current event is handled.
+func (c *Composer) resume() error {
+	if err := termbox.Init(); err != nil {
+		return err
+	}
+	termbox.SetOutputMode(termbox.OutputMode(c.outputMode))
+
+	inputMode := termbox.InputAlt
+	if c.g.InputEsc {
+		inputMode = termbox.InputEsc
+	}
+	if c.g.Mouse {
+		inputMode |= termbox.InputMouse
+	}
+	termbox.SetInputMode(inputMode)
+	return nil
+}
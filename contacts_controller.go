@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/jroimartin/gocui"
+
+	"github.com/status-im/status-go/protocol"
+)
+
+// System tags of contacts as defined by the protocol.
+const (
+	contactAddedTag   = ":contact/added"
+	contactBlockedTag = ":contact/blocked"
+)
+
+// contactToString returns a string representation.
+func contactToString(c *protocol.Contact) string {
+	name := c.Alias
+	if c.Name != "" {
+		name = fmt.Sprintf("%s (%s)", c.Alias, c.Name)
+		if c.ENSVerified {
+			name += " ✓"
+		}
+	}
+
+	var tags []string
+	if c.IsAdded() {
+		tags = append(tags, "added")
+	}
+	if c.HasBeenAdded() {
+		tags = append(tags, "added us")
+	}
+	if c.IsBlocked() {
+		tags = append(tags, "blocked")
+	}
+
+	lastUpdated := "never"
+	if c.LastUpdated > 0 {
+		lastUpdated = time.Unix(0, c.LastUpdated*int64(time.Millisecond)).Format(time.RFC822)
+	}
+
+	return fmt.Sprintf(
+		"%s | %s | %s | %s",
+		name,
+		c.ID[:9],
+		strings.Join(tags, ", "),
+		lastUpdated,
+	)
+}
+
+// ContactsViewController manages contacts view.
+type ContactsViewController struct {
+	*ViewController
+	messenger *protocol.Messenger
+	contacts  []*protocol.Contact
+	logger    *zap.Logger
+}
+
+// NewContactsViewController returns a new contacts view controller.
+func NewContactsViewController(vc *ViewController, m *protocol.Messenger, logger *zap.Logger) *ContactsViewController {
+	return &ContactsViewController{
+		ViewController: vc,
+		messenger:      m,
+		logger:         logger.With(zap.Namespace("ContactsViewController")),
+	}
+}
+
+// LoadAndRefresh loads contacts from the messenger and refreshes the view.
+func (c *ContactsViewController) LoadAndRefresh() {
+	c.load()
+	c.refresh()
+}
+
+// Toggle shows or hides the contacts view.
+func (c *ContactsViewController) Toggle() error {
+	if err := c.vm.ToggleView(c.viewName); err != nil {
+		return err
+	}
+	c.refresh()
+	return nil
+}
+
+// Contacts returns all known contacts.
+func (c *ContactsViewController) Contacts() []*protocol.Contact {
+	return c.messenger.Contacts()
+}
+
+// FindContact looks up a contact by its public key, alias or ENS name.
+func (c *ContactsViewController) FindContact(query string) (*protocol.Contact, bool) {
+	publicKey, err := publicKeyArgToString(query)
+	for _, contact := range c.messenger.Contacts() {
+		if err == nil && contact.ID == publicKey {
+			return contact, true
+		}
+		if contact.Alias == query || (contact.Name != "" && contact.Name == query) {
+			return contact, true
+		}
+	}
+	return nil, false
+}
+
+// Add saves a contact with the given public key as added.
+func (c *ContactsViewController) Add(publicKey, name string) error {
+	contact, ok := c.FindContact(publicKey)
+	if !ok {
+		contact = &protocol.Contact{ID: publicKey}
+	}
+	if name != "" {
+		contact.Name = name
+	}
+	contact.SystemTags = addTag(contact.SystemTags, contactAddedTag)
+	contact.LastUpdated = time.Now().UnixNano() / int64(time.Millisecond)
+	return c.save(contact)
+}
+
+// Rename changes a name of the contact.
+func (c *ContactsViewController) Rename(contact *protocol.Contact, name string) error {
+	contact.Name = name
+	contact.ENSVerified = false
+	return c.save(contact)
+}
+
+// Block blocks the contact. It removes all messages sent by the contact
+// and a one-to-one chat with it. Updated chats are returned.
+func (c *ContactsViewController) Block(contact *protocol.Contact) ([]*protocol.Chat, error) {
+	contact.SystemTags = addTag(contact.SystemTags, contactBlockedTag)
+	chats, err := c.messenger.BlockContact(contact)
+	if err != nil {
+		return nil, err
+	}
+	c.LoadAndRefresh()
+	return chats, nil
+}
+
+// Unblock removes the blocked tag from the contact.
+func (c *ContactsViewController) Unblock(contact *protocol.Contact) error {
+	contact.SystemTags = removeTag(contact.SystemTags, contactBlockedTag)
+	return c.save(contact)
+}
+
+func (c *ContactsViewController) save(contact *protocol.Contact) error {
+	if err := c.messenger.SaveContact(contact); err != nil {
+		return err
+	}
+	c.LoadAndRefresh()
+	return nil
+}
+
+func (c *ContactsViewController) load() {
+	contacts := c.messenger.Contacts()
+	sort.Slice(contacts, func(i, j int) bool {
+		return contacts[i].Alias < contacts[j].Alias
+	})
+	c.logger.Info("loaded contacts", zap.Int("count", len(contacts)))
+	c.contacts = contacts
+}
+
+// refresh repaints the current list of contacts.
+func (c *ContactsViewController) refresh() {
+	contacts := c.contacts
+	theme := c.vm.Theme()
+	c.g.Update(func(*gocui.Gui) error {
+		// The view exists only if it's enabled.
+		if _, err := c.view(); err != nil {
+			return nil
+		}
+		if err := c.Clear(); err != nil {
+			return err
+		}
+		for _, contact := range contacts {
+			line := contactToString(contact)
+			if contact.IsBlocked() {
+				line = styled(line, theme.Disabled)
+			}
+			if _, err := fmt.Fprintln(c.ViewController, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func addTag(tags []string, tag string) []string {
+	for _, t := range tags {
+		if t == tag {
+			return tags
+		}
+	}
+	return append(tags, tag)
+}
+
+func removeTag(tags []string, tag string) []string {
+	var result []string
+	for _, t := range tags {
+		if t != tag {
+			result = append(result, t)
+		}
+	}
+	return result
+}
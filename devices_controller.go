@@ -0,0 +1,215 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+
+	"github.com/jroimartin/gocui"
+
+	"github.com/status-im/status-go/protocol"
+	"github.com/status-im/status-go/protocol/encryption/multidevice"
+)
+
+// installationIDFile is a file in the data dir
+// which keeps the installation ID between runs.
+const installationIDFile = "installation-id"
+
+// deviceType is sent to paired devices as a type of this installation.
+const deviceType = "console"
+
+// loadOrCreateInstallationID reads the installation ID from the data dir.
+// If it does not exist yet, a new one is generated and saved.
+func loadOrCreateInstallationID(dataDir string) (string, error) {
+	path := filepath.Join(dataDir, installationIDFile)
+
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		if id := strings.TrimSpace(string(data)); id != "" {
+			return id, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	id := uuid.New().String()
+	if err := ioutil.WriteFile(path, []byte(id+"\n"), 0644); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// installationToString returns a string representation.
+func installationToString(i *multidevice.Installation, ours bool) string {
+	name := "unnamed"
+	kind := "unknown"
+	if i.InstallationMetadata != nil {
+		if i.InstallationMetadata.Name != "" {
+			name = i.InstallationMetadata.Name
+		}
+		if i.InstallationMetadata.DeviceType != "" {
+			kind = i.InstallationMetadata.DeviceType
+		}
+	}
+	if ours {
+		name += " (this device)"
+	}
+
+	status := "disabled"
+	if i.Enabled {
+		status = "enabled"
+	}
+
+	lastSeen := "never"
+	if i.Timestamp > 0 {
+		lastSeen = time.Unix(0, i.Timestamp*int64(time.Millisecond)).Format(time.RFC822)
+	}
+
+	return fmt.Sprintf("%s | %s | %s | %s | %s", i.ID, name, kind, status, lastSeen)
+}
+
+// DevicesViewController manages devices view
+// which lists our paired installations.
+type DevicesViewController struct {
+	*ViewController
+	messenger      *protocol.Messenger
+	installationID string
+	logger         *zap.Logger
+
+	// installations are loaded from other goroutines
+	// than the main loop, so they are guarded by the mutex.
+	sync.Mutex
+	installations []*multidevice.Installation
+}
+
+// NewDevicesViewController returns a new devices view controller.
+func NewDevicesViewController(vc *ViewController, m *protocol.Messenger, installationID string, logger *zap.Logger) *DevicesViewController {
+	return &DevicesViewController{
+		ViewController: vc,
+		messenger:      m,
+		installationID: installationID,
+		logger:         logger.With(zap.Namespace("DevicesViewController")),
+	}
+}
+
+// LoadAndRefresh loads installations from the storage and refreshes the view.
+func (c *DevicesViewController) LoadAndRefresh() error {
+	installations, err := c.messenger.Installations()
+	if err != nil {
+		return err
+	}
+	sort.Slice(installations, func(i, j int) bool {
+		return installations[i].Timestamp > installations[j].Timestamp
+	})
+	c.logger.Info("loaded installations", zap.Int("count", len(installations)))
+	c.Lock()
+	c.installations = installations
+	c.Unlock()
+	c.refresh()
+	return nil
+}
+
+// Toggle shows or hides the devices view.
+func (c *DevicesViewController) Toggle() error {
+	if err := c.vm.ToggleView(c.viewName); err != nil {
+		return err
+	}
+	c.refresh()
+	return nil
+}
+
+// FindInstallation looks up an installation by its ID or a unique ID prefix.
+func (c *DevicesViewController) FindInstallation(id string) (*multidevice.Installation, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	var found *multidevice.Installation
+	for _, i := range c.installations {
+		if i.ID == id {
+			return i, nil
+		}
+		if strings.HasPrefix(i.ID, id) {
+			if found != nil {
+				return nil, fmt.Errorf("installation ID %s is ambiguous", id)
+			}
+			found = i
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("installation %s not found", id)
+	}
+	return found, nil
+}
+
+// SetName changes a name of the installation.
+func (c *DevicesViewController) SetName(id, name string) error {
+	kind := ""
+	if id == c.installationID {
+		kind = deviceType
+	}
+	c.Lock()
+	for _, i := range c.installations {
+		if i.ID == id && i.InstallationMetadata != nil && i.InstallationMetadata.DeviceType != "" {
+			kind = i.InstallationMetadata.DeviceType
+		}
+	}
+	c.Unlock()
+
+	metadata := &multidevice.InstallationMetadata{Name: name, DeviceType: kind}
+	if err := c.messenger.SetInstallationMetadata(id, metadata); err != nil {
+		return err
+	}
+	return c.LoadAndRefresh()
+}
+
+// Enable enables the installation, i.e. messages will be also sent to it.
+func (c *DevicesViewController) Enable(id string) error {
+	if err := c.messenger.EnableInstallation(id); err != nil {
+		return err
+	}
+	return c.LoadAndRefresh()
+}
+
+// Disable disables the installation.
+func (c *DevicesViewController) Disable(id string) error {
+	if err := c.messenger.DisableInstallation(id); err != nil {
+		return err
+	}
+	return c.LoadAndRefresh()
+}
+
+// refresh repaints the current list of installations.
+func (c *DevicesViewController) refresh() {
+	c.Lock()
+	installations := c.installations
+	c.Unlock()
+
+	theme := c.vm.Theme()
+	c.g.Update(func(*gocui.Gui) error {
+		// The view exists only if it's enabled.
+		if _, err := c.view(); err != nil {
+			return nil
+		}
+		if err := c.Clear(); err != nil {
+			return err
+		}
+		for _, i := range installations {
+			line := installationToString(i, i.ID == c.installationID)
+			if !i.Enabled {
+				line = styled(line, theme.Disabled)
+			}
+			if _, err := fmt.Fprintln(c.ViewController, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"unicode/utf8"
+
+	"github.com/jroimartin/gocui"
+)
+
+// modalEditor is a vi-like editor used by the vi keymap preset.
+// In the insert mode, it works like the default editor.
+// In the normal mode, characters move the cursor
+// or switch back to the insert mode instead of being typed.
+type modalEditor struct {
+	normal bool
+}
+
+// Edit implements gocui.Editor.
+func (e *modalEditor) Edit(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+	if !e.normal {
+		gocui.DefaultEditor.Edit(v, key, ch, mod)
+		return
+	}
+
+	switch {
+	case ch == 'i':
+		e.normal = false
+	case ch == 'a':
+		v.MoveCursor(1, 0, false)
+		e.normal = false
+	case ch == 'I':
+		moveToLineStart(v)
+		e.normal = false
+	case ch == 'A':
+		moveToLineEnd(v)
+		e.normal = false
+	case ch == 'h' || key == gocui.KeyArrowLeft:
+		v.MoveCursor(-1, 0, false)
+	case ch == 'l' || key == gocui.KeyArrowRight:
+		v.MoveCursor(1, 0, false)
+	case ch == 'k' || key == gocui.KeyArrowUp:
+		v.MoveCursor(0, -1, false)
+	case ch == 'j' || key == gocui.KeyArrowDown:
+		v.MoveCursor(0, 1, false)
+	case ch == '0':
+		moveToLineStart(v)
+	case ch == '$':
+		moveToLineEnd(v)
+	case ch == 'x' || key == gocui.KeyDelete:
+		v.EditDelete(false)
+	}
+}
+
+// NormalMode switches to the normal mode.
+// It returns false if the editor already was in the normal mode.
+func (e *modalEditor) NormalMode() bool {
+	if e.normal {
+		return false
+	}
+	e.normal = true
+	return true
+}
+
+func moveToLineStart(v *gocui.View) {
+	_, oy := v.Origin()
+	_, cy := v.Cursor()
+	if err := v.SetOrigin(0, oy); err != nil {
+		return
+	}
+	_ = v.SetCursor(0, cy)
+}
+
+func moveToLineEnd(v *gocui.View) {
+	_, cy := v.Cursor()
+	line, err := v.Line(cy)
+	if err != nil {
+		return
+	}
+	_, oy := v.Origin()
+	maxX, _ := v.Size()
+	x := utf8.RuneCountInString(line)
+	ox := 0
+	if x >= maxX {
+		ox = x - maxX + 1
+	}
+	if err := v.SetOrigin(ox, oy); err != nil {
+		return
+	}
+	_ = v.SetCursor(x-ox, cy)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/status-im/status-go/eth-node/types"
+	transport "github.com/status-im/status-go/protocol/transport/whisper"
+)
+
+// confirmationsTracker reports messages confirmed by mail servers.
+//
+// The envelopes monitor of the messenger reports a message sent
+// once its envelope reaches any peer and it does not expose envelope
+// hashes, so later confirmations from mail servers are unknown.
+// Hashes are learnt by wrapping the Whisper API used by the messenger:
+// envelopes posted while a message is sent belong to it and envelopes
+// posted again with the same payload belong to the same message.
+// They are watched by a second envelopes monitor which accepts
+// only mail server confirmations.
+type confirmationsTracker struct {
+	monitor *transport.EnvelopesMonitor
+	handler *envelopeEventsHandler
+	logger  *zap.Logger
+
+	// sendLock makes sure that envelopes posted
+	// while sending belong to a single message.
+	sendLock sync.Mutex
+
+	sync.Mutex
+	// sending is true while a message is being sent
+	// and posted collects hashes of its envelopes.
+	sending bool
+	posted  []postedEnvelope
+	// messages maps envelope hashes and payloads to message IDs.
+	messages map[string]string
+	payloads map[string]string
+	// confirmed keeps hashes confirmed before their messages were known.
+	confirmed map[string]bool
+}
+
+type postedEnvelope struct {
+	hash    string
+	payload string
+}
+
+func newConfirmationsTracker(handler *envelopeEventsHandler, logger *zap.Logger) *confirmationsTracker {
+	return &confirmationsTracker{
+		handler:   handler,
+		logger:    logger.With(zap.Namespace("confirmationsTracker")),
+		messages:  make(map[string]string),
+		payloads:  make(map[string]string),
+		confirmed: make(map[string]bool),
+	}
+}
+
+// Start starts watching mail server confirmations. It returns a node
+// which must be used by the messenger so that posted envelopes are tracked.
+func (t *confirmationsTracker) Start(node types.Node, isMailserver func(types.EnodeID) bool) (types.Node, error) {
+	w, err := node.GetWhisper(nil)
+	if err != nil {
+		return nil, err
+	}
+	t.monitor = transport.NewEnvelopesMonitor(w, transport.EnvelopesMonitorConfig{
+		EnvelopeEventsHandler:          confirmationsHandler{t},
+		MaxAttempts:                    1,
+		MailserverConfirmationsEnabled: true,
+		IsMailserver:                   isMailserver,
+		Logger:                         t.logger,
+	})
+	t.monitor.Start()
+	return &trackedNode{Node: node, whisper: &trackedWhisper{Whisper: w, tracker: t}}, nil
+}
+
+// Send calls send and assigns envelopes posted meanwhile
+// to the message with the ID returned by send.
+func (t *confirmationsTracker) Send(send func() (messageID string, err error)) error {
+	t.sendLock.Lock()
+	defer t.sendLock.Unlock()
+
+	t.Lock()
+	t.sending = true
+	t.posted = nil
+	t.Unlock()
+
+	id, err := send()
+
+	t.Lock()
+	defer t.Unlock()
+	t.sending = false
+	if err != nil {
+		for _, e := range t.posted {
+			delete(t.confirmed, e.hash)
+		}
+		t.posted = nil
+		return err
+	}
+	var confirmed bool
+	for _, e := range t.posted {
+		t.messages[e.hash] = id
+		t.payloads[e.payload] = id
+		if t.confirmed[e.hash] {
+			delete(t.confirmed, e.hash)
+			confirmed = true
+		}
+	}
+	t.posted = nil
+	if confirmed {
+		t.confirm(id)
+	}
+	return nil
+}
+
+// post is called after an envelope was posted.
+func (t *confirmationsTracker) post(hash []byte, message types.NewMessage) {
+	e := postedEnvelope{hash: types.EncodeHex(hash), payload: string(message.Payload)}
+
+	t.Lock()
+	if id, ok := t.payloads[e.payload]; ok {
+		// The envelope was posted again after it expired.
+		t.messages[e.hash] = id
+	} else if t.sending {
+		t.posted = append(t.posted, e)
+	} else {
+		t.Unlock()
+		return
+	}
+	t.Unlock()
+
+	// The hash is the only identifier so that it can be
+	// confirmed before the message ID is known.
+	// The monitor calls the handler with its lock held
+	// so it must not be called with the tracker lock held.
+	t.monitor.Add([][]byte{hash}, types.BytesToHash(hash), message)
+}
+
+// envelopeConfirmed is called when a mail server confirmed the envelope.
+func (t *confirmationsTracker) envelopeConfirmed(hash string) {
+	t.Lock()
+	defer t.Unlock()
+
+	id, ok := t.messages[hash]
+	if !ok {
+		t.confirmed[hash] = true
+		return
+	}
+	t.confirm(id)
+}
+
+// confirm reports the message confirmed and forgets its envelopes.
+// It must be called with the lock held.
+func (t *confirmationsTracker) confirm(id string) {
+	for hash, messageID := range t.messages {
+		if messageID == id {
+			delete(t.messages, hash)
+		}
+	}
+	for payload, messageID := range t.payloads {
+		if messageID == id {
+			delete(t.payloads, payload)
+		}
+	}
+	t.handler.forward([]string{id}, OutgoingStatusConfirmed)
+}
+
+// forget drops envelopes of messages which expired.
+func (t *confirmationsTracker) forget(ids []string) {
+	t.Lock()
+	defer t.Unlock()
+
+	expired := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		expired[id] = true
+	}
+	for hash, id := range t.messages {
+		if expired[id] {
+			delete(t.messages, hash)
+		}
+	}
+	for payload, id := range t.payloads {
+		if expired[id] {
+			delete(t.payloads, payload)
+		}
+	}
+}
+
+// confirmationsHandler receives events of the confirmations monitor
+// whose envelopes are identified by their hashes.
+type confirmationsHandler struct {
+	tracker *confirmationsTracker
+}
+
+var _ transport.EnvelopeEventsHandler = confirmationsHandler{}
+
+// EnvelopeSent is called when envelopes were confirmed by a mail server.
+func (h confirmationsHandler) EnvelopeSent(identifiers [][]byte) {
+	for _, hash := range identifiers {
+		h.tracker.envelopeConfirmed(types.EncodeHex(hash))
+	}
+}
+
+// EnvelopeExpired is a no-op. Expired envelopes are posted again
+// and reported by the envelopes monitor of the messenger.
+func (h confirmationsHandler) EnvelopeExpired([][]byte, error) {}
+
+func (h confirmationsHandler) MailServerRequestCompleted(types.Hash, types.Hash, []byte, error) {}
+
+func (h confirmationsHandler) MailServerRequestExpired(types.Hash) {}
+
+// trackedNode returns Whisper which reports posted envelopes to the tracker.
+type trackedNode struct {
+	types.Node
+	whisper *trackedWhisper
+}
+
+func (n *trackedNode) GetWhisper(ctx interface{}) (types.Whisper, error) {
+	return n.whisper, nil
+}
+
+type trackedWhisper struct {
+	types.Whisper
+	tracker *confirmationsTracker
+}
+
+func (w *trackedWhisper) PublicWhisperAPI() types.PublicWhisperAPI {
+	return &trackedWhisperAPI{PublicWhisperAPI: w.Whisper.PublicWhisperAPI(), tracker: w.tracker}
+}
+
+type trackedWhisperAPI struct {
+	types.PublicWhisperAPI
+	tracker *confirmationsTracker
+}
+
+func (a *trackedWhisperAPI) Post(ctx context.Context, req types.NewMessage) ([]byte, error) {
+	hash, err := a.PublicWhisperAPI.Post(ctx, req)
+	if err == nil {
+		a.tracker.post(hash, req)
+	}
+	return hash, err
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"go.uber.org/zap"
+
+	"github.com/status-im/status-go/eth-node/types"
+	"github.com/status-im/status-go/protocol"
+	transport "github.com/status-im/status-go/protocol/transport/whisper"
+)
+
+// Outgoing statuses of messages in addition
+// to the ones defined in the protocol package.
+const (
+	// OutgoingStatusConfirmed means that a mail server confirmed receiving the message.
+	OutgoingStatusConfirmed = "confirmed"
+	// OutgoingStatusExpired means that the message was not sent to any peer in time.
+	OutgoingStatusExpired = "expired"
+	// OutgoingStatusFailed means that the message could not be sent at all.
+	OutgoingStatusFailed = "failed"
+)
+
+// maxMessageDeliveryAttempts is a number of times
+// an envelope is posted before it's considered expired.
+const maxMessageDeliveryAttempts = 6
+
+type outgoingStatusEvent struct {
+	MessageIDs []string
+	Status     string
+}
+
+var _ transport.EnvelopeEventsHandler = (*envelopeEventsHandler)(nil)
+
+// envelopeEventsHandler receives events about sent envelopes
+// and translates them into outgoing statuses of messages.
+type envelopeEventsHandler struct {
+	// confirmations tracks mail server confirmations of sent messages.
+	// If nil, messages are never confirmed.
+	confirmations *confirmationsTracker
+	out           chan outgoingStatusEvent
+
+	// queue keeps events which were not read yet. It's unbounded
+	// so that the envelopes monitor is never blocked and no status is lost.
+	mu     sync.Mutex
+	queue  []outgoingStatusEvent
+	queued chan struct{}
+}
+
+func newEnvelopeEventsHandler() *envelopeEventsHandler {
+	h := &envelopeEventsHandler{
+		out:    make(chan outgoingStatusEvent),
+		queued: make(chan struct{}, 1),
+	}
+	go h.deliver()
+	return h
+}
+
+// TrackConfirmations makes the handler report messages confirmed
+// by mail servers. The returned node must be used by the messenger.
+func (h *envelopeEventsHandler) TrackConfirmations(node types.Node, isMailserver func(types.EnodeID) bool, logger *zap.Logger) (types.Node, error) {
+	tracker := newConfirmationsTracker(h, logger)
+	node, err := tracker.Start(node, isMailserver)
+	if err != nil {
+		return nil, err
+	}
+	h.confirmations = tracker
+	return node, nil
+}
+
+// TrackSend calls send which sends a message and returns its ID,
+// so that the message can be confirmed by mail servers.
+func (h *envelopeEventsHandler) TrackSend(send func() (messageID string, err error)) error {
+	if h.confirmations == nil {
+		_, err := send()
+		return err
+	}
+	return h.confirmations.Send(send)
+}
+
+// Events returns a channel with outgoing statuses changes.
+func (h *envelopeEventsHandler) Events() <-chan outgoingStatusEvent {
+	return h.out
+}
+
+// EnvelopeSent is called when envelopes were sent to a peer.
+// Mail server confirmations are reported later by the confirmations tracker.
+func (h *envelopeEventsHandler) EnvelopeSent(identifiers [][]byte) {
+	h.forward(encodeIdentifiers(identifiers), protocol.OutgoingStatusSent)
+}
+
+// EnvelopeExpired is called when envelopes expired
+// and all delivery attempts failed.
+func (h *envelopeEventsHandler) EnvelopeExpired(identifiers [][]byte, err error) {
+	log.Printf("envelope expired: %v", err)
+	ids := encodeIdentifiers(identifiers)
+	if h.confirmations != nil {
+		h.confirmations.forget(ids)
+	}
+	h.forward(ids, OutgoingStatusExpired)
+}
+
+// MailServerRequestCompleted is a no-op. The envelopes monitor does not
+// report mail server requests; they are tracked with Whisper events
+// forwarded by signalForwarder, see forwardMailServerRequests.
+func (h *envelopeEventsHandler) MailServerRequestCompleted(types.Hash, types.Hash, []byte, error) {}
+
+// MailServerRequestExpired is a no-op, see MailServerRequestCompleted.
+func (h *envelopeEventsHandler) MailServerRequestExpired(types.Hash) {}
+
+func encodeIdentifiers(identifiers [][]byte) []string {
+	ids := make([]string, len(identifiers))
+	for i, id := range identifiers {
+		ids[i] = types.EncodeHex(id)
+	}
+	return ids
+}
+
+// forward queues the event without blocking the envelopes monitor.
+func (h *envelopeEventsHandler) forward(ids []string, status string) {
+	h.mu.Lock()
+	h.queue = append(h.queue, outgoingStatusEvent{MessageIDs: ids, Status: status})
+	h.mu.Unlock()
+
+	select {
+	case h.queued <- struct{}{}:
+	default:
+	}
+}
+
+// deliver passes queued events to the events channel in order.
+func (h *envelopeEventsHandler) deliver() {
+	for range h.queued {
+		h.mu.Lock()
+		events := h.queue
+		h.queue = nil
+		h.mu.Unlock()
+
+		for _, event := range events {
+			h.out <- event
+		}
+	}
+}
@@ -22,12 +22,13 @@ require (
 	github.com/fatih/color v1.7.0
 	github.com/gballet/go-libpcsclite v0.0.0-20191108122812-4678299bea08 // indirect
 	github.com/golang-migrate/migrate/v4 v4.7.0 // indirect
+	github.com/gomarkdown/markdown v0.0.0-20191209105822-e3ba6c6109ba
 	github.com/google/uuid v1.1.1
 	github.com/gorilla/mux v1.7.3 // indirect
 	github.com/jroimartin/gocui v0.4.0
 	github.com/karalabe/usb v0.0.0-20191104083709-911d15fe12a9 // indirect
 	github.com/mattn/go-colorable v0.1.2 // indirect
-	github.com/nsf/termbox-go v0.0.0-20190624072549-eeb6cd0a1762 // indirect
+	github.com/nsf/termbox-go v0.0.0-20190624072549-eeb6cd0a1762
 	github.com/onsi/ginkgo v1.10.1 // indirect
 	github.com/onsi/gomega v1.7.0 // indirect
 	github.com/peterbourgon/ff v1.2.0
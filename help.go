@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+)
+
+// HelpViewController shows help in a popup view
+// which is closed with Enter or Esc.
+// It is accessed only from the main loop.
+type HelpViewController struct {
+	*ViewController
+}
+
+// NewHelpViewController returns a new help view controller.
+func NewHelpViewController(vc *ViewController) *HelpViewController {
+	return &HelpViewController{ViewController: vc}
+}
+
+// Show displays the text in the help view and selects it.
+func (h *HelpViewController) Show(title, text string) error {
+	view := h.vm.ViewByName(h.viewName)
+	view.Title = "help: " + title
+	if !view.Enabled {
+		if err := h.vm.EnableView(h.viewName); err != nil {
+			return err
+		}
+	}
+	if err := h.Clear(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(h, text)
+	return err
+}
+
+// Close hides the help view and selects the previous view.
+func (h *HelpViewController) Close() error {
+	if !h.vm.ViewByName(h.viewName).Enabled {
+		return nil
+	}
+	return h.vm.ToggleView(h.viewName)
+}
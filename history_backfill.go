@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/status-im/status-go/protocol"
+)
+
+// historyFile is a file in the data dir which keeps
+// the last synced timestamps of chats between runs.
+const historyFile = "history.json"
+
+const (
+	// initialBackfillWindow is requested for chats which were never synced.
+	initialBackfillWindow = 24 * time.Hour
+	// maxBackfillWindow is a limit of the requested window.
+	// Mail servers do not keep older envelopes anyway.
+	maxBackfillWindow = 30 * 24 * time.Hour
+	// syncedUpdateInterval is how often the last synced timestamps
+	// are moved forward while the mail server is connected.
+	syncedUpdateInterval = time.Minute
+)
+
+var errBackfillInProgress = errors.New("history backfill is already in progress")
+
+// HistoryBackfiller requests messages missed while the client was offline.
+//
+// It keeps a last synced timestamp per chat. While the selected
+// mail server is connected, all messages are received live
+// and the timestamps are moved forward. When the mail server
+// connects, after start or a disconnection, the missing window is requested.
+// Chats which still miss it are reported as having gaps.
+type HistoryBackfiller struct {
+	messenger   *protocol.Messenger
+	mailservers *MailserversViewController
+	path        string
+	logger      *zap.Logger
+	onGaps      func(chatIDs []string)
+
+	sync.Mutex
+	// synced maps chat IDs to the last synced time in seconds.
+	synced    map[string]int64
+	gaps      map[string]bool
+	connected bool
+	running   bool
+}
+
+// NewHistoryBackfiller returns a new history backfiller.
+// onGaps is called with IDs of chats with unfilled gaps every time they change.
+func NewHistoryBackfiller(
+	m *protocol.Messenger,
+	mailservers *MailserversViewController,
+	dataDir string,
+	logger *zap.Logger,
+	onGaps func([]string),
+) *HistoryBackfiller {
+	return &HistoryBackfiller{
+		messenger:   m,
+		mailservers: mailservers,
+		path:        filepath.Join(dataDir, historyFile),
+		logger:      logger.With(zap.Namespace("HistoryBackfiller")),
+		onGaps:      onGaps,
+		synced:      make(map[string]int64),
+		gaps:        make(map[string]bool),
+	}
+}
+
+// Start loads the last synced timestamps and watches peers
+// to request the missing history when the selected mail server connects.
+func (b *HistoryBackfiller) Start(peers <-chan []string) error {
+	data, err := ioutil.ReadFile(b.path)
+	if err == nil {
+		b.Lock()
+		err = json.Unmarshal(data, &b.synced)
+		b.Unlock()
+		if err != nil {
+			return err
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	go b.watchPeers(peers)
+	go b.updateSyncedLoop()
+
+	return nil
+}
+
+// Gaps returns IDs of chats which miss some history.
+func (b *HistoryBackfiller) Gaps() []string {
+	b.Lock()
+	defer b.Unlock()
+	return b.gapsList()
+}
+
+// Backfill requests messages of all active chats since
+// the oldest last synced timestamp until now.
+func (b *HistoryBackfiller) Backfill(ctx context.Context, progress func(page int)) (int, error) {
+	mailserver, ok := b.mailservers.Selected()
+	if !ok {
+		return 0, errors.New("no mail server available")
+	}
+
+	b.Lock()
+	if b.running {
+		b.Unlock()
+		return 0, errBackfillInProgress
+	}
+	b.running = true
+
+	to := time.Now()
+	from := to
+	var chatIDs []string
+	for _, chat := range b.messenger.Chats() {
+		if !chat.Active {
+			continue
+		}
+		chatIDs = append(chatIDs, chat.ID)
+
+		synced := to.Add(-initialBackfillWindow)
+		if t, ok := b.synced[chat.ID]; ok {
+			synced = time.Unix(t, 0)
+		}
+		if synced.Before(from) {
+			from = synced
+		}
+		// The chat misses messages until the request completes.
+		if to.Sub(synced) > syncedUpdateInterval {
+			b.gaps[chat.ID] = true
+		}
+	}
+	if from.Before(to.Add(-maxBackfillWindow)) {
+		from = to.Add(-maxBackfillWindow)
+	}
+	gaps := b.gapsList()
+	b.Unlock()
+
+	b.onGaps(gaps)
+
+	b.logger.Info("requesting missing history", zap.Time("from", from), zap.Time("to", to), zap.Int("chats", len(chatIDs)))
+	pages, err := b.mailservers.RequestHistory(ctx, mailserver, from, to, progress)
+
+	b.Lock()
+	b.running = false
+	if err == nil {
+		// A completed request proves that the mail server is connected.
+		b.connected = true
+		for _, id := range chatIDs {
+			b.synced[id] = to.Unix()
+			delete(b.gaps, id)
+		}
+	}
+	gaps = b.gapsList()
+	b.Unlock()
+
+	b.onGaps(gaps)
+
+	if err != nil {
+		return pages, err
+	}
+	return pages, b.save()
+}
+
+func (b *HistoryBackfiller) backfillAndLog() {
+	pages, err := b.Backfill(context.Background(), func(int) {})
+	if err != nil {
+		b.logger.Error("failed to backfill history", zap.Error(err))
+		return
+	}
+	b.logger.Info("history backfilled", zap.Int("pages", pages))
+}
+
+// watchPeers requests the missing history
+// when the selected mail server becomes connected.
+func (b *HistoryBackfiller) watchPeers(peers <-chan []string) {
+	for ids := range peers {
+		mailserver, ok := b.mailservers.Selected()
+		if !ok {
+			continue
+		}
+
+		connected := false
+		for _, id := range ids {
+			if id == mailserver.ID {
+				connected = true
+				break
+			}
+		}
+
+		b.Lock()
+		reconnected := connected && !b.connected
+		b.connected = connected
+		b.Unlock()
+
+		if reconnected {
+			b.logger.Info("mail server connected", zap.String("id", mailserver.ID))
+			go b.backfillAndLog()
+		}
+	}
+}
+
+// updateSyncedLoop moves the last synced timestamps forward
+// while the mail server is connected and chats have no gaps.
+func (b *HistoryBackfiller) updateSyncedLoop() {
+	ticker := time.NewTicker(syncedUpdateInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		b.Lock()
+		if !b.connected || b.running {
+			b.Unlock()
+			continue
+		}
+		for id := range b.synced {
+			if !b.gaps[id] {
+				b.synced[id] = now.Unix()
+			}
+		}
+		b.Unlock()
+
+		if err := b.save(); err != nil {
+			b.logger.Error("failed to save last synced timestamps", zap.Error(err))
+		}
+	}
+}
+
+func (b *HistoryBackfiller) save() error {
+	b.Lock()
+	data, err := json.Marshal(b.synced)
+	b.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(b.path, data, 0644)
+}
+
+// gapsList must be called with the lock held.
+func (b *HistoryBackfiller) gapsList() []string {
+	var ids []string
+	for id := range b.gaps {
+		ids = append(ids, id)
+	}
+	return ids
+}
@@ -2,8 +2,14 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"math"
+	"strconv"
 	"strings"
+	"time"
+	"unicode"
 
 	"github.com/jroimartin/gocui"
 
@@ -12,17 +18,25 @@ import (
 	"github.com/status-im/status-go/protocol"
 )
 
-const DefaultMultiplexerPrefix = "default"
-
+// CmdHandler handles input which is not a command.
 type CmdHandler func([]byte) error
 
+// InputMultiplexer passes the input to a registered command
+// with the same name as the first word of the input
+// or to the default handler if it does not start with "/".
+//
+// Errors of commands are displayed as notifications.
 type InputMultiplexer struct {
-	handlers map[string]CmdHandler // map string prefix to handler
+	commands       map[string]*Command
+	defaultHandler CmdHandler
+	notifications  *NotificationViewController
 }
 
-func NewInputMultiplexer() *InputMultiplexer {
+// NewInputMultiplexer returns a new multiplexer reporting errors as notifications.
+func NewInputMultiplexer(notifications *NotificationViewController) *InputMultiplexer {
 	return &InputMultiplexer{
-		handlers: make(map[string]CmdHandler),
+		commands:      make(map[string]*Command),
+		notifications: notifications,
 	}
 }
 
@@ -36,80 +50,694 @@ func (m *InputMultiplexer) BindingHandler(g *gocui.Gui, v *gocui.View) error {
 		return err
 	}
 
-	inputStr := buf.String()
-	inputBytes := bytes.TrimSpace(buf.Bytes())
+	return m.Handle(buf.Bytes())
+}
+
+// Handle runs the command the input starts with or passes
+// the input to the default handler. A leading "//" is sent
+// as a single "/" so messages can start with a slash.
+func (m *InputMultiplexer) Handle(input []byte) error {
+	text := strings.TrimSpace(string(input))
 
-	for prefix, h := range m.handlers {
-		if strings.HasPrefix(inputStr, prefix) {
-			return h(inputBytes)
+	if !strings.HasPrefix(text, "/") || strings.HasPrefix(text, "//") {
+		if m.defaultHandler == nil {
+			return nil
+		}
+		if strings.HasPrefix(text, "//") {
+			text = text[1:]
 		}
+		return m.defaultHandler([]byte(text))
 	}
 
-	if h, ok := m.handlers[DefaultMultiplexerPrefix]; ok {
-		return h(inputBytes)
+	name, rest := text, ""
+	if i := strings.IndexFunc(text, unicode.IsSpace); i != -1 {
+		name, rest = text[:i], text[i:]
+	}
+
+	cmd, ok := m.commands[name]
+	if !ok {
+		m.notifications.Error(name, "unknown command; type /help to list commands")
+		return nil
 	}
 
+	if err := m.run(cmd, rest); err != nil {
+		m.notifications.Error(name, err.Error())
+	}
 	return nil
 }
 
-func (m *InputMultiplexer) AddHandler(prefix string, h CmdHandler) {
-	m.handlers[prefix] = h
+func (m *InputMultiplexer) run(cmd *Command, rest string) error {
+	tokens, err := splitArgs(rest)
+	if err != nil {
+		return err
+	}
+	sub, args, err := cmd.resolve(tokens, rest)
+	if err != nil {
+		return err
+	}
+	return sub.Run(args)
+}
+
+// SetDefaultHandler sets a handler of the input which is not a command.
+func (m *InputMultiplexer) SetDefaultHandler(h CmdHandler) {
+	m.defaultHandler = h
 }
 
-func bytesToArgs(b []byte) []string {
-	args := bytes.Split(b, []byte(" "))
-	argsStr := make([]string, len(args))
-	for i, arg := range args {
-		argsStr[i] = string(arg)
+// AddCommand registers the command under its name.
+func (m *InputMultiplexer) AddCommand(cmd *Command) {
+	m.commands[cmd.Name] = cmd
+}
+
+// Command returns a registered command by its name.
+func (m *InputMultiplexer) Command(name string) (*Command, bool) {
+	cmd, ok := m.commands[name]
+	return cmd, ok
+}
+
+// Commands returns registered commands sorted by name.
+func (m *InputMultiplexer) Commands() []*Command {
+	return sortedCommands(m.commands)
+}
+
+func chatAddCmdHandler(name, alias string) (chat protocol.Chat, err error) {
+	if alias == "" {
+		return protocol.CreatePublicChat(name), nil
+	}
+	publicKeyBytes, err := types.DecodeHex(name)
+	if err != nil {
+		return chat, err
 	}
-	return argsStr
+	publicKey, err := crypto.UnmarshalPubkey(publicKeyBytes)
+	if err != nil {
+		return chat, err
+	}
+	return protocol.CreateOneToOneChat(alias, publicKey), nil
 }
 
-func chatAddCmdHandler(args []string) (chat protocol.Chat, err error) {
-	if len(args) == 1 {
-		name := args[0]
-		chat = protocol.CreatePublicChat(name)
-	} else if len(args) == 2 {
-		publicKeyBytes, err := types.DecodeHex(args[0])
-		if err != nil {
-			return chat, err
+func ChatCmdFactory(chatsvc *ChatsViewController, chatvc *MessagesViewController) *Command {
+	return &Command{
+		Name: "/chat",
+		Subcommands: []*Command{
+			{
+				Name:    "add",
+				Summary: "joins a public chat or starts a one-to-one chat with a name",
+				Usage:   "add <topic>|<public-key> [<name>]",
+				Args: []ArgSpec{
+					{Name: "topic", Complete: completeContacts},
+					{Name: "name", Optional: true, Help: "a name of a one-to-one chat"},
+				},
+				Run: func(args *Args) error {
+					chat, err := chatAddCmdHandler(args.String("topic"), args.String("name"))
+					if err != nil {
+						return err
+					}
+					return chatsvc.Add(chat)
+				},
+			},
+			{
+				Name:    "remove",
+				Summary: "stops receiving messages of the chat",
+				Args: []ArgSpec{
+					{Name: "chat", Type: ArgChat, Help: "a chat name, a public key of a contact or a position in the chats list"},
+					{Name: "purge", Type: ArgChoice, Choices: []string{"purge"}, Optional: true},
+				},
+				Run: func(args *Args) error {
+					chat, ok := chatsvc.FindChat(args.String("chat"))
+					if !ok {
+						return errors.New("chat " + args.String("chat") + " not found")
+					}
+					if err := chatsvc.Remove(*chat, args.Has("purge")); err != nil {
+						return err
+					}
+					chatvc.RemoveChat(chat.ID)
+					return nil
+				},
+			},
+		},
+	}
+}
+
+// groupCmdTimeout is a maximum time a group chat command
+// can take to propagate membership updates.
+const groupCmdTimeout = 10 * time.Second
+
+// publicKeyArgToString validates a hex-encoded public key argument
+// and returns it in the format used as a chat member ID.
+func publicKeyArgToString(arg string) (string, error) {
+	publicKeyBytes, err := types.DecodeHex(arg)
+	if err != nil {
+		return "", err
+	}
+	publicKey, err := crypto.UnmarshalPubkey(publicKeyBytes)
+	if err != nil {
+		return "", err
+	}
+	return types.EncodeHex(crypto.FromECDSAPub(publicKey)), nil
+}
+
+func activeGroupChat(chatvc *MessagesViewController) (*protocol.Chat, error) {
+	chat := chatvc.ActiveChat()
+	if chat == nil || chat.ChatType != protocol.ChatTypePrivateGroupChat {
+		return nil, errors.New("select a group chat first")
+	}
+	return chat, nil
+}
+
+func GroupCmdFactory(chatsvc *ChatsViewController, chatvc *MessagesViewController, notifications *NotificationViewController) *Command {
+	members := ArgSpec{Name: "member", Type: ArgPublicKey, Variadic: true, Help: "a public key of a member"}
+
+	// applyResponses shows messages from the responses on the main loop.
+	// Failed calls leave nil responses which are skipped.
+	applyResponses := func(responses ...*protocol.MessengerResponse) {
+		chatvc.g.Update(func(*gocui.Gui) error {
+			for _, response := range responses {
+				if response != nil {
+					chatvc.handleRetrievedMessages(response)
+				}
+			}
+			return nil
+		})
+	}
+
+	// activeGroupCmd returns a subcommand operating on the selected group chat.
+	// The group chat is updated in the background so that the main loop
+	// is not blocked by network calls and errors are shown as notifications.
+	activeGroupCmd := func(
+		name, summary string,
+		args []ArgSpec,
+		run func(ctx context.Context, chat *protocol.Chat, args *Args) ([]*protocol.MessengerResponse, error),
+	) *Command {
+		return &Command{
+			Name:    name,
+			Summary: summary,
+			Args:    args,
+			Run: func(args *Args) error {
+				chat, err := activeGroupChat(chatvc)
+				if err != nil {
+					return err
+				}
+
+				go func() {
+					ctx, cancel := context.WithTimeout(context.Background(), groupCmdTimeout)
+					defer cancel()
+
+					// Responses are applied even if the command failed
+					// as some updates, e.g. kicked members, might succeed.
+					responses, err := run(ctx, chat, args)
+					applyResponses(responses...)
+					if err != nil {
+						notifications.Error("Group chat", err.Error())
+					}
+				}()
+				return nil
+			},
 		}
-		publicKey, err := crypto.UnmarshalPubkey(publicKeyBytes)
+	}
+
+	optionalMembers := members
+	optionalMembers.Optional = true
+
+	return &Command{
+		Name: "/group",
+		Subcommands: []*Command{
+			{
+				Name:    "create",
+				Summary: "creates a new group chat and selects it",
+				Args:    []ArgSpec{{Name: "name"}, optionalMembers},
+				Run: func(args *Args) error {
+					name, members := args.String("name"), args.Strings("member")
+
+					go func() {
+						ctx, cancel := context.WithTimeout(context.Background(), groupCmdTimeout)
+						defer cancel()
+
+						response, err := chatsvc.CreateGroup(ctx, name, members)
+						if err != nil {
+							notifications.Error("Group chat", err.Error())
+							return
+						}
+						applyResponses(response)
+						if len(response.Chats) > 0 {
+							chatvc.Select(response.Chats[0])
+						}
+					}()
+					return nil
+				},
+			},
+			activeGroupCmd("invite", "adds new members", []ArgSpec{members},
+				func(ctx context.Context, chat *protocol.Chat, args *Args) ([]*protocol.MessengerResponse, error) {
+					response, err := chatsvc.InviteToGroup(ctx, chat.ID, args.Strings("member"))
+					return []*protocol.MessengerResponse{response}, err
+				}),
+			activeGroupCmd("kick", "removes members", []ArgSpec{members},
+				func(ctx context.Context, chat *protocol.Chat, args *Args) ([]*protocol.MessengerResponse, error) {
+					var responses []*protocol.MessengerResponse
+					for _, member := range args.Strings("member") {
+						response, err := chatsvc.KickFromGroup(ctx, chat.ID, member)
+						if err != nil {
+							return responses, err
+						}
+						responses = append(responses, response)
+					}
+					return responses, nil
+				}),
+			activeGroupCmd("promote", "makes members admins", []ArgSpec{members},
+				func(ctx context.Context, chat *protocol.Chat, args *Args) ([]*protocol.MessengerResponse, error) {
+					response, err := chatsvc.PromoteInGroup(ctx, chat.ID, args.Strings("member"))
+					return []*protocol.MessengerResponse{response}, err
+				}),
+			activeGroupCmd("accept", "confirms joining the group chat we were invited to", nil,
+				func(ctx context.Context, chat *protocol.Chat, args *Args) ([]*protocol.MessengerResponse, error) {
+					response, err := chatsvc.AcceptGroupInvitation(ctx, chat.ID)
+					return []*protocol.MessengerResponse{response}, err
+				}),
+			activeGroupCmd("leave", "leaves the group chat", nil,
+				func(ctx context.Context, chat *protocol.Chat, args *Args) ([]*protocol.MessengerResponse, error) {
+					response, err := chatsvc.LeaveGroup(ctx, chat.ID)
+					return []*protocol.MessengerResponse{response}, err
+				}),
+		},
+	}
+}
+
+// resendCmdTimeout is a maximum time resending a message can take.
+const resendCmdTimeout = 5 * time.Second
+
+func ResendCmdFactory(chatvc *MessagesViewController) *Command {
+	return &Command{
+		Name:    "/resend",
+		Summary: "sends again an own message of the selected chat",
+		Args: []ArgSpec{{
+			Name:     "message",
+			Type:     ArgMessage,
+			Help:     `a message ID or its prefix; "last" resends the last expired or failed message`,
+			Complete: completeAny(completeWords("last"), completeMessages),
+		}},
+		Run: func(args *Args) error {
+			var message *protocol.Message
+			if id := args.String("message"); id == "last" {
+				m, ok := chatvc.LastFailedMessage()
+				if !ok {
+					return errors.New("no expired or failed messages")
+				}
+				message = m
+			} else {
+				m, err := chatvc.FindMessage(id)
+				if err != nil {
+					return err
+				}
+				message = m
+			}
+
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), resendCmdTimeout)
+				defer cancel()
+				// errors are reported by the controller
+				_ = chatvc.Resend(ctx, message)
+			}()
+
+			return nil
+		},
+	}
+}
+
+func contactByArg(contactsvc *ContactsViewController, arg string) (*protocol.Contact, error) {
+	contact, ok := contactsvc.FindContact(arg)
+	if !ok {
+		return nil, errors.New("contact " + arg + " not found")
+	}
+	return contact, nil
+}
+
+func ContactCmdFactory(contactsvc *ContactsViewController, chatsvc *ChatsViewController, chatvc *MessagesViewController) *Command {
+	contact := ArgSpec{Name: "contact", Type: ArgContact, Help: "a public key, an alias or a name of a contact"}
+
+	return &Command{
+		Name: "/contact",
+		Subcommands: []*Command{
+			{
+				Name:    "add",
+				Summary: "adds a new contact",
+				Args: []ArgSpec{
+					{Name: "public-key", Type: ArgPublicKey},
+					{Name: "name", Optional: true},
+				},
+				Run: func(args *Args) error {
+					return contactsvc.Add(args.String("public-key"), args.String("name"))
+				},
+			},
+			{
+				Name:    "rename",
+				Summary: "changes a name of the contact",
+				Args:    []ArgSpec{contact, {Name: "name"}},
+				Run: func(args *Args) error {
+					contact, err := contactByArg(contactsvc, args.String("contact"))
+					if err != nil {
+						return err
+					}
+					return contactsvc.Rename(contact, args.String("name"))
+				},
+			},
+			{
+				Name:    "block",
+				Summary: "blocks the contact and removes its messages and one-to-one chat",
+				Args:    []ArgSpec{contact},
+				Run: func(args *Args) error {
+					contact, err := contactByArg(contactsvc, args.String("contact"))
+					if err != nil {
+						return err
+					}
+					chats, err := contactsvc.Block(contact)
+					if err != nil {
+						return err
+					}
+					chatvc.RemoveChat(contact.ID)
+					chatvc.RemoveMessagesFrom(contact.ID)
+					chatsvc.SetChats(chats)
+					return nil
+				},
+			},
+			{
+				Name:    "unblock",
+				Summary: "unblocks the contact",
+				Args:    []ArgSpec{contact},
+				Run: func(args *Args) error {
+					contact, err := contactByArg(contactsvc, args.String("contact"))
+					if err != nil {
+						return err
+					}
+					return contactsvc.Unblock(contact)
+				},
+			},
+			{
+				Name:    "list",
+				Summary: "shows the contacts view",
+				Run: func(args *Args) error {
+					contactsvc.LoadAndRefresh()
+					if contactsvc.vm.ViewByName(contactsvc.viewName).Enabled {
+						return nil
+					}
+					return contactsvc.Toggle()
+				},
+			},
+		},
+	}
+}
+
+func DevicesCmdFactory(devicesvc *DevicesViewController) *Command {
+	installation := ArgSpec{Name: "installation", Help: "an installation ID or its unique prefix"}
+
+	return &Command{
+		Name: "/devices",
+		Subcommands: []*Command{
+			{
+				Name:    "list",
+				Summary: "shows the devices view with paired installations",
+				Run: func(args *Args) error {
+					if err := devicesvc.LoadAndRefresh(); err != nil {
+						return err
+					}
+					if devicesvc.vm.ViewByName(devicesvc.viewName).Enabled {
+						return nil
+					}
+					return devicesvc.Toggle()
+				},
+			},
+			{
+				Name:    "name",
+				Summary: "names this or another installation",
+				// The installation is optional but comes first.
+				Usage: "name [<installation>] <name>",
+				Args:  []ArgSpec{installation, {Name: "name", Optional: true}},
+				Run: func(args *Args) error {
+					if !args.Has("name") {
+						return devicesvc.SetName(devicesvc.installationID, args.String("installation"))
+					}
+					installation, err := devicesvc.FindInstallation(args.String("installation"))
+					if err != nil {
+						return err
+					}
+					return devicesvc.SetName(installation.ID, args.String("name"))
+				},
+			},
+			{
+				Name:    "enable",
+				Summary: "enables sending messages to the installation",
+				Args:    []ArgSpec{installation},
+				Run: func(args *Args) error {
+					installation, err := devicesvc.FindInstallation(args.String("installation"))
+					if err != nil {
+						return err
+					}
+					return devicesvc.Enable(installation.ID)
+				},
+			},
+			{
+				Name:    "disable",
+				Summary: "disables the installation",
+				Args:    []ArgSpec{installation},
+				Run: func(args *Args) error {
+					installation, err := devicesvc.FindInstallation(args.String("installation"))
+					if err != nil {
+						return err
+					}
+					return devicesvc.Disable(installation.ID)
+				},
+			},
+		},
+	}
+}
+
+func MailserverCmdFactory(mailserversvc *MailserversViewController) *Command {
+	mailserver := ArgSpec{Name: "mailserver", Help: "a mail server ID or its unique prefix"}
+
+	return &Command{
+		Name: "/mailserver",
+		Subcommands: []*Command{
+			{
+				Name:    "list",
+				Summary: "shows the mail servers view",
+				Run: func(args *Args) error {
+					if mailserversvc.vm.ViewByName(mailserversvc.viewName).Enabled {
+						return nil
+					}
+					return mailserversvc.Toggle()
+				},
+			},
+			{
+				Name:    "add",
+				Summary: "adds a new mail server",
+				Args:    []ArgSpec{{Name: "enode"}},
+				Run: func(args *Args) error {
+					return mailserversvc.Add(args.String("enode"))
+				},
+			},
+			{
+				Name:    "remove",
+				Summary: "removes the mail server",
+				Args:    []ArgSpec{mailserver},
+				Run: func(args *Args) error {
+					mailserver, err := mailserversvc.FindMailserver(args.String("mailserver"))
+					if err != nil {
+						return err
+					}
+					return mailserversvc.Remove(mailserver)
+				},
+			},
+			{
+				Name:    "select",
+				Summary: "connects to the mail server and uses it for requests",
+				Args:    []ArgSpec{mailserver},
+				Run: func(args *Args) error {
+					mailserver, err := mailserversvc.FindMailserver(args.String("mailserver"))
+					if err != nil {
+						return err
+					}
+					return mailserversvc.Select(mailserver)
+				},
+			},
+		},
+	}
+}
+
+// parseHistoryDuration parses a duration which can also be given in days, e.g. "3d".
+func parseHistoryDuration(arg string) (time.Duration, error) {
+	if strings.HasSuffix(arg, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(arg, "d"))
 		if err != nil {
-			return chat, err
+			return 0, err
 		}
-		chat = protocol.CreateOneToOneChat(args[1], publicKey)
-	} else {
-		err = errors.New("/chat: incorrect arguments to add subcommand")
+		return time.Duration(days) * 24 * time.Hour, nil
 	}
-	return
+	return time.ParseDuration(arg)
 }
 
-func ChatCmdFactory(chatsvc *ChatsViewController, chatvc *MessagesViewController) CmdHandler {
-	return func(b []byte) error {
-		args := bytesToArgs(b)[1:] // remove first item, i.e. "/chat"
+func RequestCmdFactory(
+	mailserversvc *MailserversViewController,
+	chatsvc *ChatsViewController,
+	chatvc *MessagesViewController,
+	notifications *NotificationViewController,
+) *Command {
+	return &Command{
+		Name:    "/request",
+		Summary: "requests historic messages of all chats and reloads the chat",
+		Args: []ArgSpec{
+			{Name: "duration", Type: ArgDuration, Help: "how far back to request messages, e.g. 12h or 3d"},
+			{Name: "reload-chat", Type: ArgChat, Optional: true, Help: "a chat to reload when completed; the current one if omitted"},
+		},
+		Run: func(args *Args) error {
+			duration := args.Duration("duration")
+
+			// Messages are requested for all chats, the chat is only reloaded.
+			chat := chatvc.ActiveChat()
+			if args.Has("reload-chat") {
+				c, ok := chatsvc.FindChat(args.String("reload-chat"))
+				if !ok {
+					return errors.New("chat " + args.String("reload-chat") + " not found")
+				}
+				chat = c
+			}
+
+			mailserver, ok := mailserversvc.Selected()
+			if !ok {
+				return errors.New("no mail server available")
+			}
+
+			to := time.Now()
+			from := to.Add(-duration)
 
-		switch args[0] {
-		case "add":
-			chat, err := chatAddCmdHandler(args[1:])
+			go func() {
+				notifications.Info("History request", "requesting messages since "+from.Format(time.RFC822))
+
+				pages, err := mailserversvc.RequestHistory(context.Background(), mailserver, from, to, func(page int) {
+					notifications.Info("History request", fmt.Sprintf("received page %d", page))
+				})
+				if err != nil {
+					notifications.Error("History request", fmt.Sprintf("failed after %d pages: %v", pages, err))
+					return
+				}
+
+				notifications.Info("History request", fmt.Sprintf("completed, received %d pages", pages))
+
+				// Reload the chat to show the historic messages.
+				if chat != nil {
+					chatvc.Select(chat)
+				}
+			}()
+
+			return nil
+		},
+	}
+}
+
+func SyncCmdFactory(backfiller *HistoryBackfiller, notifications *NotificationViewController) *Command {
+	return &Command{
+		Name:    "/sync",
+		Summary: "requests the missing history of chats again",
+		Run: func(args *Args) error {
+			go func() {
+				pages, err := backfiller.Backfill(context.Background(), func(page int) {
+					notifications.Info("History sync", fmt.Sprintf("received page %d", page))
+				})
+				if err != nil {
+					notifications.Error("History sync", fmt.Sprintf("failed after %d pages: %v", pages, err))
+					return
+				}
+				notifications.Info("History sync", fmt.Sprintf("completed, received %d pages", pages))
+			}()
+
+			return nil
+		},
+	}
+}
+
+// sendCmdTimeout is a maximum time sending a message from a command can take.
+const sendCmdTimeout = 5 * time.Second
+
+func StickerCmdFactory(chatvc *MessagesViewController) *Command {
+	return &Command{
+		Name:    "/sticker",
+		Summary: "sends a sticker from the pack with the given content hash",
+		Args:    []ArgSpec{{Name: "pack", Type: ArgInt}, {Name: "hash"}},
+		Run: func(args *Args) error {
+			pack := args.Int("pack")
+			if pack < math.MinInt32 || pack > math.MaxInt32 {
+				return fmt.Errorf("invalid pack %d", pack)
+			}
+			hash := args.String("hash")
+
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), sendCmdTimeout)
+				defer cancel()
+				// errors are reported by the controller
+				_, _ = chatvc.SendSticker(ctx, int32(pack), hash)
+			}()
+
+			return nil
+		},
+	}
+}
+
+func EmojiCmdFactory(chatvc *MessagesViewController) *Command {
+	return &Command{
+		Name:    "/emoji",
+		Summary: "sends an emoji message",
+		Args:    []ArgSpec{{Name: "emoji"}},
+		Run: func(args *Args) error {
+			emoji := args.String("emoji")
+
+			go func() {
+				ctx, cancel := context.WithTimeout(context.Background(), sendCmdTimeout)
+				defer cancel()
+				// errors are reported by the controller
+				_, _ = chatvc.SendEmoji(ctx, emoji)
+			}()
+
+			return nil
+		},
+	}
+}
+
+// ComposeCmdFactory opens the editor with the text following the command.
+func ComposeCmdFactory(g *gocui.Gui, composer *Composer) *Command {
+	return &Command{
+		Name:    "/compose",
+		Summary: "writes a message in an external editor",
+		Args:    []ArgSpec{{Name: "text", Type: ArgText, Optional: true}},
+		Run: func(args *Args) error {
+			v, err := g.View(ViewInput)
 			if err != nil {
 				return err
 			}
-			if err := chatsvc.Add(chat); err != nil {
-				return err
+			return composer.Compose(v, args.String("text"))
+		},
+	}
+}
+
+// HelpCmdFactory shows usage of all commands or the given one.
+func HelpCmdFactory(m *InputMultiplexer, helpvc *HelpViewController) *Command {
+	return &Command{
+		Name:    "/help",
+		Summary: "shows usage of commands",
+		Args:    []ArgSpec{{Name: "command", Optional: true, Complete: completeCommands}},
+		Run: func(args *Args) error {
+			if !args.Has("command") {
+				return helpvc.Show("commands", formatHelp(m.Commands())+"\n\n"+helpFooter)
 			}
-			// TODO: fix removing chats
-			// case "remove":
-			//	if len(args) == 2 {
-			//		if err := c.Remove(args[1]); err != nil {
-			//			return err
-			//		}
-			//		c.Refresh()
-			//		return nil
-			//	}
-			//	return errors.New("/chat: incorect arguments to remove subcommand")
-		}
 
-		return nil
+			name := args.String("command")
+			if !strings.HasPrefix(name, "/") {
+				name = "/" + name
+			}
+			cmd, ok := m.Command(name)
+			if !ok {
+				return errors.New("unknown command " + name)
+			}
+			return helpvc.Show(name, formatHelp([]*Command{cmd}))
+		},
 	}
 }
+
+// helpFooter is displayed below the list of commands.
+const helpFooter = `Arguments with spaces can be quoted, e.g. /contact rename alice "Alice B".
+A message starting with "/" is sent by typing "//".`
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/jroimartin/gocui"
+	"go.uber.org/zap"
+)
+
+// inputHistoryFile is a file in the data dir which keeps
+// sent lines and unsent drafts between runs.
+const inputHistoryFile = "input_history.json"
+
+// maxInputHistory is a number of lines remembered per chat
+// and a number of remembered commands.
+const maxInputHistory = 100
+
+// historyEntry is a sent line. Commands do not belong to any chat.
+type historyEntry struct {
+	Text   string `json:"text"`
+	ChatID string `json:"chat,omitempty"`
+}
+
+// inputHistoryConfig is a format of the input history file.
+type inputHistoryConfig struct {
+	Entries []historyEntry `json:"entries"`
+	// Drafts maps chat IDs to unsent text.
+	Drafts map[string]string `json:"drafts"`
+}
+
+// InputHistory remembers lines sent from the input view
+// and drafts of chats which were not sent before switching them.
+//
+// Lines sent to a chat are recalled only in that chat
+// while commands are recalled in all chats.
+// It is accessed only from the main loop.
+type InputHistory struct {
+	path   string
+	logger *zap.Logger
+
+	entries []historyEntry
+	drafts  map[string]string
+	chatID  string
+
+	// browsed is an index of the recalled entry
+	// in the visible entries or -1 if none is recalled.
+	browsed int
+	// pending is the text typed before recalling entries.
+	pending string
+}
+
+// NewInputHistory returns a new input history kept in the data dir.
+func NewInputHistory(dataDir string, logger *zap.Logger) *InputHistory {
+	return &InputHistory{
+		path:    filepath.Join(dataDir, inputHistoryFile),
+		logger:  logger.With(zap.Namespace("InputHistory")),
+		drafts:  make(map[string]string),
+		browsed: -1,
+	}
+}
+
+// Load loads the history from the data dir.
+func (h *InputHistory) Load() error {
+	data, err := ioutil.ReadFile(h.path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	var config inputHistoryConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return err
+	}
+	h.entries = config.Entries
+	if config.Drafts != nil {
+		h.drafts = config.Drafts
+	}
+	return nil
+}
+
+func (h *InputHistory) save() {
+	data, err := json.Marshal(inputHistoryConfig{Entries: h.entries, Drafts: h.drafts})
+	if err == nil {
+		err = ioutil.WriteFile(h.path, data, 0600)
+	}
+	if err != nil {
+		h.logger.Error("failed to save input history", zap.Error(err))
+	}
+}
+
+// Add remembers a line sent to the active chat.
+func (h *InputHistory) Add(text string) {
+	h.browsed = -1
+	h.pending = ""
+	delete(h.drafts, h.chatID)
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return
+	}
+
+	entry := historyEntry{Text: text, ChatID: h.chatID}
+	// "//" escapes a message starting with a slash.
+	if strings.HasPrefix(text, "/") && !strings.HasPrefix(text, "//") {
+		entry.ChatID = ""
+	}
+	if visible := h.visible(); len(visible) == 0 || visible[len(visible)-1] != text {
+		h.entries = append(h.entries, entry)
+		h.trim()
+	}
+	h.save()
+}
+
+// trim drops the oldest entries of chats and commands over the limit.
+func (h *InputHistory) trim() {
+	counts := make(map[string]int)
+	var entries []historyEntry
+	for i := len(h.entries) - 1; i >= 0; i-- {
+		e := h.entries[i]
+		counts[e.ChatID]++
+		if counts[e.ChatID] <= maxInputHistory {
+			entries = append(entries, e)
+		}
+	}
+	// restore the chronological order
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	h.entries = entries
+}
+
+// visible returns texts of entries which can be recalled in the active chat.
+func (h *InputHistory) visible() []string {
+	var texts []string
+	for _, e := range h.entries {
+		if e.ChatID == "" || e.ChatID == h.chatID {
+			texts = append(texts, e.Text)
+		}
+	}
+	return texts
+}
+
+// Previous replaces the input with the previous entry.
+// If the cursor is not in the first line, it's moved up instead.
+func (h *InputHistory) Previous(v *gocui.View) error {
+	_, oy := v.Origin()
+	_, cy := v.Cursor()
+	if oy+cy > 0 {
+		v.MoveCursor(0, -1, false)
+		return nil
+	}
+
+	visible := h.visible()
+	if h.browsed == -1 {
+		h.pending = inputText(v)
+		h.browsed = len(visible)
+	}
+	if h.browsed == 0 {
+		return nil
+	}
+	h.browsed--
+	return setInputText(v, visible[h.browsed])
+}
+
+// Next replaces the input with the next entry or the text typed
+// before recalling entries. If the cursor is not in the last line,
+// it's moved down instead.
+func (h *InputHistory) Next(v *gocui.View) error {
+	_, oy := v.Origin()
+	_, cy := v.Cursor()
+	if oy+cy < len(v.BufferLines())-1 {
+		v.MoveCursor(0, 1, false)
+		return nil
+	}
+
+	if h.browsed == -1 {
+		return nil
+	}
+	h.browsed++
+	visible := h.visible()
+	if h.browsed >= len(visible) {
+		h.browsed = -1
+		return setInputText(v, h.pending)
+	}
+	return setInputText(v, visible[h.browsed])
+}
+
+// SwitchChat keeps the input as a draft of the previous chat
+// and replaces it with a draft of the next chat.
+// The previous chat ID is empty if no chat was active.
+func (h *InputHistory) SwitchChat(v *gocui.View, previous, next string) error {
+	if previous == next && h.chatID == next {
+		return nil
+	}
+	h.chatID = next
+	h.browsed = -1
+	h.pending = ""
+
+	text := inputText(v)
+	draft, ok := h.drafts[next]
+	// The text typed before selecting any chat is kept.
+	if previous == "" && strings.TrimSpace(text) != "" {
+		return nil
+	}
+
+	if strings.TrimSpace(text) == "" {
+		delete(h.drafts, previous)
+	} else {
+		h.drafts[previous] = text
+	}
+	h.save()
+
+	if !ok {
+		draft = ""
+	}
+	return setInputText(v, draft)
+}
+
+// SaveDraft keeps the input as a draft of the active chat.
+// It's used before quitting.
+func (h *InputHistory) SaveDraft(v *gocui.View) {
+	if h.chatID == "" {
+		return
+	}
+	if text := inputText(v); strings.TrimSpace(text) != "" {
+		h.drafts[h.chatID] = text
+	} else {
+		delete(h.drafts, h.chatID)
+	}
+	h.save()
+}
+
+// inputText returns the text of the input view.
+func inputText(v *gocui.View) string {
+	return strings.TrimRight(v.Buffer(), "\n")
+}
+
+// setInputText replaces the text of the input view
+// and moves the cursor to its end.
+func setInputText(v *gocui.View, text string) error {
+	v.Clear()
+	if err := v.SetOrigin(0, 0); err != nil {
+		return err
+	}
+	if err := v.SetCursor(0, 0); err != nil {
+		return err
+	}
+	for _, r := range text {
+		if r == '\n' {
+			v.EditNewLine()
+		} else {
+			v.EditWrite(r)
+		}
+	}
+	return nil
+}
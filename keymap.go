@@ -0,0 +1,523 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jroimartin/gocui"
+)
+
+// keymapFile is a file in the data dir with custom key bindings.
+const keymapFile = "keymap.json"
+
+// globalKeymapView is a name used in keymap files for global bindings.
+const globalKeymapView = "global"
+
+// Keymap presets.
+const (
+	KeymapPresetDefault = "default"
+	KeymapPresetVi      = "vi"
+)
+
+// Names of actions which can be bound to keys.
+const (
+	ActionQuit                = "quit"
+	ActionNextView            = "next-view"
+	ActionCursorDown          = "cursor-down"
+	ActionCursorUp            = "cursor-up"
+	ActionHome                = "home"
+	ActionEnd                 = "end"
+	ActionSelectChat          = "select-chat"
+	ActionReply               = "reply"
+	ActionResend              = "resend"
+	ActionToggleMarkdown      = "toggle-markdown"
+	ActionSubmit              = "submit"
+	ActionNewline             = "newline"
+	ActionCancelReply         = "cancel-reply"
+	ActionComplete            = "complete"
+	ActionHistoryPrevious     = "history-previous"
+	ActionHistoryNext         = "history-next"
+	ActionCompose             = "compose"
+	ActionNormalMode          = "normal-mode"
+	ActionToggleContacts      = "toggle-contacts"
+	ActionToggleDevices       = "toggle-devices"
+	ActionToggleMailservers   = "toggle-mailservers"
+	ActionToggleNotifications = "toggle-notifications"
+	ActionDismissNotification = "dismiss-notification"
+	ActionCloseHelp           = "close-help"
+	ActionQuickSwitch         = "quick-switch"
+	ActionCloseSwitcher       = "close-switcher"
+)
+
+var knownActions = []string{
+	ActionQuit,
+	ActionNextView,
+	ActionCursorDown,
+	ActionCursorUp,
+	ActionHome,
+	ActionEnd,
+	ActionSelectChat,
+	ActionReply,
+	ActionResend,
+	ActionToggleMarkdown,
+	ActionSubmit,
+	ActionNewline,
+	ActionCancelReply,
+	ActionComplete,
+	ActionHistoryPrevious,
+	ActionHistoryNext,
+	ActionCompose,
+	ActionNormalMode,
+	ActionToggleContacts,
+	ActionToggleDevices,
+	ActionToggleMailservers,
+	ActionToggleNotifications,
+	ActionDismissNotification,
+	ActionCloseHelp,
+	ActionQuickSwitch,
+	ActionCloseSwitcher,
+}
+
+// keymapViews are views which can have key bindings.
+var keymapViews = []string{
+	globalKeymapView,
+	ViewChats,
+	ViewChat,
+	ViewInput,
+	ViewContacts,
+	ViewDevices,
+	ViewMailservers,
+	ViewNotification,
+	ViewHelp,
+	ViewSwitcher,
+}
+
+// ActionTable maps names of actions to their handlers.
+// An action can have a different handler in some views.
+type ActionTable struct {
+	// handlers maps actions to view names and handlers.
+	// An empty view name is used for handlers working in any view.
+	handlers map[string]map[string]GocuiHandler
+}
+
+// NewActionTable returns an empty action table.
+func NewActionTable() *ActionTable {
+	return &ActionTable{handlers: make(map[string]map[string]GocuiHandler)}
+}
+
+// Add registers a handler of the action working in any view.
+func (t *ActionTable) Add(action string, handler GocuiHandler) {
+	t.AddForView(action, "", handler)
+}
+
+// AddForView registers a handler of the action in the given view.
+func (t *ActionTable) AddForView(action, view string, handler GocuiHandler) {
+	if t.handlers[action] == nil {
+		t.handlers[action] = make(map[string]GocuiHandler)
+	}
+	t.handlers[action][view] = handler
+}
+
+// Handler returns a handler of the action in the view.
+// Global bindings use an empty view name.
+func (t *ActionTable) Handler(action, view string) (GocuiHandler, bool) {
+	handlers, ok := t.handlers[action]
+	if !ok {
+		return nil, false
+	}
+	if h, ok := handlers[view]; ok && view != "" {
+		return h, true
+	}
+	h, ok := handlers[""]
+	return h, ok
+}
+
+// keyChord is a key with a modifier.
+// Either key or ch is set.
+type keyChord struct {
+	key gocui.Key
+	ch  rune
+	mod gocui.Modifier
+}
+
+// gocuiKey returns the key in a format accepted by gocui.
+func (c keyChord) gocuiKey() interface{} {
+	if c.ch != 0 {
+		return c.ch
+	}
+	return c.key
+}
+
+var namedKeys = map[string]gocui.Key{
+	"f1":         gocui.KeyF1,
+	"f2":         gocui.KeyF2,
+	"f3":         gocui.KeyF3,
+	"f4":         gocui.KeyF4,
+	"f5":         gocui.KeyF5,
+	"f6":         gocui.KeyF6,
+	"f7":         gocui.KeyF7,
+	"f8":         gocui.KeyF8,
+	"f9":         gocui.KeyF9,
+	"f10":        gocui.KeyF10,
+	"f11":        gocui.KeyF11,
+	"f12":        gocui.KeyF12,
+	"insert":     gocui.KeyInsert,
+	"delete":     gocui.KeyDelete,
+	"home":       gocui.KeyHome,
+	"end":        gocui.KeyEnd,
+	"pgup":       gocui.KeyPgup,
+	"pgdn":       gocui.KeyPgdn,
+	"up":         gocui.KeyArrowUp,
+	"down":       gocui.KeyArrowDown,
+	"left":       gocui.KeyArrowLeft,
+	"right":      gocui.KeyArrowRight,
+	"enter":      gocui.KeyEnter,
+	"tab":        gocui.KeyTab,
+	"esc":        gocui.KeyEsc,
+	"space":      gocui.KeySpace,
+	"backspace":  gocui.KeyBackspace2,
+	"ctrl+space": gocui.KeyCtrlSpace,
+	"ctrl+a":     gocui.KeyCtrlA,
+	"ctrl+b":     gocui.KeyCtrlB,
+	"ctrl+c":     gocui.KeyCtrlC,
+	"ctrl+d":     gocui.KeyCtrlD,
+	"ctrl+e":     gocui.KeyCtrlE,
+	"ctrl+f":     gocui.KeyCtrlF,
+	"ctrl+g":     gocui.KeyCtrlG,
+	"ctrl+h":     gocui.KeyCtrlH,
+	"ctrl+i":     gocui.KeyCtrlI,
+	"ctrl+j":     gocui.KeyCtrlJ,
+	"ctrl+k":     gocui.KeyCtrlK,
+	"ctrl+l":     gocui.KeyCtrlL,
+	"ctrl+m":     gocui.KeyCtrlM,
+	"ctrl+n":     gocui.KeyCtrlN,
+	"ctrl+o":     gocui.KeyCtrlO,
+	"ctrl+p":     gocui.KeyCtrlP,
+	"ctrl+q":     gocui.KeyCtrlQ,
+	"ctrl+r":     gocui.KeyCtrlR,
+	"ctrl+s":     gocui.KeyCtrlS,
+	"ctrl+t":     gocui.KeyCtrlT,
+	"ctrl+u":     gocui.KeyCtrlU,
+	"ctrl+v":     gocui.KeyCtrlV,
+	"ctrl+w":     gocui.KeyCtrlW,
+	"ctrl+x":     gocui.KeyCtrlX,
+	"ctrl+y":     gocui.KeyCtrlY,
+	"ctrl+z":     gocui.KeyCtrlZ,
+}
+
+// parseKeyChord parses chords like "ctrl+r", "alt+enter", "f2" or "G".
+// Names of keys are case-insensitive but single characters are not.
+func parseKeyChord(s string) (keyChord, error) {
+	var chord keyChord
+
+	name := s
+	if strings.HasPrefix(strings.ToLower(name), "alt+") {
+		chord.mod = gocui.ModAlt
+		name = name[len("alt+"):]
+	}
+
+	if utf8.RuneCountInString(name) == 1 {
+		chord.ch, _ = utf8.DecodeRuneInString(name)
+		if chord.ch == ' ' {
+			chord.ch = 0
+			chord.key = gocui.KeySpace
+		}
+		return chord, nil
+	}
+
+	key, ok := namedKeys[strings.ToLower(name)]
+	if !ok {
+		return chord, fmt.Errorf("unknown key %q", s)
+	}
+	chord.key = key
+	return chord, nil
+}
+
+// keymapConfig is a format of the keymap file.
+type keymapConfig struct {
+	Preset string `json:"preset"`
+	// Bindings maps view names to key chords and actions.
+	// An empty action removes a binding.
+	Bindings map[string]map[string]string `json:"bindings"`
+}
+
+// Keymap maps key chords to actions per view.
+type Keymap struct {
+	Preset   string
+	bindings map[string]map[keyChord]string
+	// names keeps chords as they were written for error messages.
+	names map[keyChord]string
+}
+
+// presetBindings returns bindings of the preset.
+func presetBindings(preset string) (map[string]map[string]string, error) {
+	listBindings := map[string]string{
+		"down": ActionCursorDown,
+		"up":   ActionCursorUp,
+	}
+	bindings := map[string]map[string]string{
+		globalKeymapView: {
+			"ctrl+c": ActionQuit,
+			"tab":    ActionNextView,
+			"f2":     ActionToggleContacts,
+			"f3":     ActionToggleDevices,
+			"f4":     ActionToggleMailservers,
+			"f5":     ActionToggleNotifications,
+			"ctrl+k": ActionQuickSwitch,
+		},
+		ViewChats: {
+			"down":  ActionCursorDown,
+			"up":    ActionCursorUp,
+			"enter": ActionSelectChat,
+		},
+		ViewChat: {
+			"down":   ActionCursorDown,
+			"up":     ActionCursorUp,
+			"home":   ActionHome,
+			"end":    ActionEnd,
+			"ctrl+r": ActionReply,
+			"ctrl+e": ActionResend,
+			"ctrl+t": ActionToggleMarkdown,
+		},
+		ViewInput: {
+			"enter":     ActionSubmit,
+			"alt+enter": ActionNewline,
+			"esc":       ActionCancelReply,
+			"tab":       ActionComplete,
+			"up":        ActionHistoryPrevious,
+			"down":      ActionHistoryNext,
+			"ctrl+e":    ActionCompose,
+		},
+		ViewContacts:    listBindings,
+		ViewDevices:     listBindings,
+		ViewMailservers: listBindings,
+		ViewNotification: {
+			"down":  ActionCursorDown,
+			"up":    ActionCursorUp,
+			"enter": ActionDismissNotification,
+			"esc":   ActionDismissNotification,
+		},
+		ViewHelp: {
+			"down":  ActionCursorDown,
+			"up":    ActionCursorUp,
+			"enter": ActionCloseHelp,
+			"esc":   ActionCloseHelp,
+		},
+		ViewSwitcher: {
+			"down":  ActionCursorDown,
+			"up":    ActionCursorUp,
+			"tab":   ActionCursorDown,
+			"enter": ActionSelectChat,
+			"esc":   ActionCloseSwitcher,
+		},
+	}
+
+	switch preset {
+	case "", KeymapPresetDefault:
+	case KeymapPresetVi:
+		viListBindings := map[string]string{
+			"down": ActionCursorDown,
+			"up":   ActionCursorUp,
+			"j":    ActionCursorDown,
+			"k":    ActionCursorUp,
+			"g":    ActionHome,
+			"G":    ActionEnd,
+		}
+		for _, view := range []string{ViewContacts, ViewDevices, ViewMailservers} {
+			bindings[view] = viListBindings
+		}
+		for chord, action := range viListBindings {
+			bindings[ViewNotification][chord] = action
+			bindings[ViewHelp][chord] = action
+		}
+		for chord, action := range viListBindings {
+			bindings[ViewChats][chord] = action
+			bindings[ViewChat][chord] = action
+		}
+		bindings[ViewChats]["l"] = ActionSelectChat
+		bindings[ViewChat]["r"] = ActionReply
+		bindings[ViewChat]["e"] = ActionResend
+		bindings[ViewChat]["m"] = ActionToggleMarkdown
+		bindings[ViewInput]["esc"] = ActionNormalMode
+	default:
+		return nil, fmt.Errorf("unknown keymap preset %q", preset)
+	}
+
+	return bindings, nil
+}
+
+// LoadKeymap loads the keymap file and applies it on top of its preset.
+// If the file does not exist and it's optional, only the preset is used.
+// A non-empty preset overrides the one from the file.
+func LoadKeymap(path string, optional bool, preset string) (*Keymap, error) {
+	var config keymapConfig
+
+	data, err := ioutil.ReadFile(path)
+	if err == nil {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("invalid keymap file %s: %v", path, err)
+		}
+	} else if !os.IsNotExist(err) || !optional {
+		return nil, err
+	}
+
+	if preset != "" {
+		config.Preset = preset
+	}
+
+	bindings, err := presetBindings(config.Preset)
+	if err != nil {
+		return nil, err
+	}
+
+	keymap := &Keymap{
+		Preset:   config.Preset,
+		bindings: make(map[string]map[keyChord]string),
+		names:    make(map[keyChord]string),
+	}
+	if keymap.Preset == "" {
+		keymap.Preset = KeymapPresetDefault
+	}
+	if err := keymap.add(bindings, false); err != nil {
+		return nil, err
+	}
+	if err := keymap.add(config.Bindings, true); err != nil {
+		return nil, fmt.Errorf("invalid keymap file %s: %v", path, err)
+	}
+	return keymap, nil
+}
+
+// add validates the bindings and adds them to the keymap.
+// If strict is true, each key can be bound only once in a view.
+func (k *Keymap) add(bindings map[string]map[string]string, strict bool) error {
+	var errs []string
+
+	views := make([]string, 0, len(bindings))
+	for view := range bindings {
+		views = append(views, view)
+	}
+	sort.Strings(views)
+
+	for _, view := range views {
+		if !containsString(keymapViews, view) {
+			errs = append(errs, fmt.Sprintf("unknown view %q", view))
+			continue
+		}
+
+		names := make([]string, 0, len(bindings[view]))
+		for name := range bindings[view] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		added := make(map[keyChord]string)
+		for _, name := range names {
+			action := bindings[view][name]
+
+			chord, err := parseKeyChord(name)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("view %s: %v", view, err))
+				continue
+			}
+			if action != "" && !containsString(knownActions, action) {
+				errs = append(errs, fmt.Sprintf("view %s: key %s: unknown action %q", view, name, action))
+				continue
+			}
+			// Characters must be left for typing.
+			if chord.ch != 0 && chord.mod == gocui.ModNone && (view == ViewInput || view == globalKeymapView) {
+				errs = append(errs, fmt.Sprintf("view %s: key %s: characters can't be bound globally or in the input view", view, name))
+				continue
+			}
+			if other, ok := added[chord]; ok && strict {
+				errs = append(errs, fmt.Sprintf("view %s: keys %s and %s are the same", view, other, name))
+				continue
+			}
+			added[chord] = name
+
+			if k.bindings[view] == nil {
+				k.bindings[view] = make(map[keyChord]string)
+			}
+			if action == "" {
+				delete(k.bindings[view], chord)
+			} else {
+				k.bindings[view][chord] = action
+			}
+			k.names[chord] = name
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Bindings returns key bindings of the view with handlers from the action table.
+// Global bindings use an empty view name. They are skipped in views
+// which bind the same keys so that view bindings take precedence.
+// It fails if any action is not available in the view.
+func (k *Keymap) Bindings(view string, actions *ActionTable) ([]Binding, error) {
+	keymapView := view
+	if view == "" {
+		keymapView = globalKeymapView
+	}
+
+	var (
+		bindings []Binding
+		errs     []string
+	)
+	for chord, action := range k.bindings[keymapView] {
+		handler, ok := actions.Handler(action, view)
+		if !ok {
+			errs = append(errs, fmt.Sprintf("view %s: key %s: action %s is not available", keymapView, k.names[chord], action))
+			continue
+		}
+		if view == "" {
+			handler = k.skipOverridden(chord, handler)
+		}
+		bindings = append(bindings, Binding{
+			Key:     chord.gocuiKey(),
+			Mod:     chord.mod,
+			Handler: handler,
+		})
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, fmt.Errorf("invalid keymap: %s", strings.Join(errs, "; "))
+	}
+	return bindings, nil
+}
+
+// skipOverridden wraps a handler of a global binding
+// so that it does nothing in views binding the same chord.
+func (k *Keymap) skipOverridden(chord keyChord, handler GocuiHandler) GocuiHandler {
+	overridden := make(map[string]bool)
+	for view, bindings := range k.bindings {
+		if _, ok := bindings[chord]; ok && view != globalKeymapView {
+			overridden[view] = true
+		}
+	}
+	if len(overridden) == 0 {
+		return handler
+	}
+	return func(g *gocui.Gui, v *gocui.View) error {
+		if v != nil && overridden[v.Name()] {
+			return nil
+		}
+		return handler(g, v)
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
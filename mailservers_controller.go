@@ -0,0 +1,430 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/p2p/enode"
+	"go.uber.org/zap"
+
+	"github.com/jroimartin/gocui"
+
+	"github.com/status-im/status-go/eth-node/types"
+	"github.com/status-im/status-go/protocol"
+)
+
+// mailserversFile is a file in the data dir
+// which keeps the mail servers between runs.
+const mailserversFile = "mailservers.json"
+
+// mailserver is a mail server known by the client.
+type mailserver struct {
+	ID    string
+	Enode string
+	node  *enode.Node
+}
+
+func newMailserver(enodeURL string) (*mailserver, error) {
+	node, err := enode.ParseV4(enodeURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid enode %s: %v", enodeURL, err)
+	}
+	return &mailserver{
+		ID:    node.ID().String(),
+		Enode: enodeURL,
+		node:  node,
+	}, nil
+}
+
+// PeerID returns an ID of the peer used in requests to the mail server.
+func (m *mailserver) PeerID() []byte {
+	id := m.node.ID()
+	return id[:]
+}
+
+// mailserverToString returns a string representation.
+func mailserverToString(m *mailserver, selected bool) string {
+	str := fmt.Sprintf("%s | %s:%d", m.ID[:16], m.node.IP(), m.node.TCP())
+	if selected {
+		str += " | selected"
+	}
+	return str
+}
+
+// mailserversConfig is a format of the mailservers file.
+type mailserversConfig struct {
+	Mailservers []string `json:"mailservers"`
+	Selected    string   `json:"selected"`
+}
+
+// MailserversViewController manages mail servers
+// used to request historic messages.
+//
+// The messenger does not keep mail servers yet
+// so they are also stored in the data dir.
+type MailserversViewController struct {
+	*ViewController
+	messenger *protocol.Messenger
+	signals   *signalForwarder
+	addPeer   func(string) error
+	path      string
+	logger    *zap.Logger
+
+	// requestLock serializes history requests, so that
+	// a sent request signal can be matched with its request.
+	requestLock sync.Mutex
+
+	// onRequests is called with a number of history requests in flight
+	// when a request starts or finishes.
+	onRequests func(requests int)
+
+	sync.Mutex
+	mailservers []*mailserver
+	selected    string
+	requests    int
+}
+
+// NewMailserversViewController returns a new mail servers view controller.
+// addPeer is used to connect to the selected mail server.
+// Requests are tracked with mail server request signals.
+func NewMailserversViewController(
+	vc *ViewController,
+	m *protocol.Messenger,
+	signals *signalForwarder,
+	addPeer func(string) error,
+	dataDir string,
+	logger *zap.Logger,
+) *MailserversViewController {
+	return &MailserversViewController{
+		ViewController: vc,
+		messenger:      m,
+		signals:        signals,
+		addPeer:        addPeer,
+		path:           filepath.Join(dataDir, mailserversFile),
+		logger:         logger.With(zap.Namespace("MailserversViewController")),
+		onRequests:     func(int) {},
+	}
+}
+
+// OnRequestsChanged sets a callback called with a number of history requests
+// in flight when a request starts or finishes.
+// It must be called before requesting history.
+func (c *MailserversViewController) OnRequestsChanged(fn func(requests int)) {
+	c.onRequests = fn
+}
+
+// addRequests changes a number of history requests in flight by delta.
+func (c *MailserversViewController) addRequests(delta int) {
+	c.Lock()
+	c.requests += delta
+	requests := c.requests
+	c.Unlock()
+	c.onRequests(requests)
+}
+
+// Load loads mail servers from the data dir. If there are none,
+// the trusted mail servers from the node config are used.
+// The selected mail server is connected.
+func (c *MailserversViewController) Load(trusted []string) error {
+	var config mailserversConfig
+
+	data, err := ioutil.ReadFile(c.path)
+	if err == nil {
+		if err := json.Unmarshal(data, &config); err != nil {
+			return err
+		}
+	} else if os.IsNotExist(err) {
+		config.Mailservers = trusted
+	} else {
+		return err
+	}
+
+	// The messenger takes precedence if it supports mail servers.
+	if enodes, err := c.messenger.Mailservers(); err == nil {
+		config.Mailservers = enodes
+	} else if err != protocol.ErrNotImplemented {
+		return err
+	}
+
+	c.Lock()
+	c.mailservers = nil
+	for _, e := range config.Mailservers {
+		m, err := newMailserver(e)
+		if err != nil {
+			c.logger.Warn("skipping invalid mail server", zap.String("enode", e), zap.Error(err))
+			continue
+		}
+		c.mailservers = append(c.mailservers, m)
+	}
+	c.selected = config.Selected
+	c.Unlock()
+
+	c.logger.Info("loaded mail servers", zap.Int("count", len(config.Mailservers)))
+
+	if m, ok := c.Selected(); ok {
+		if err := c.addPeer(m.Enode); err != nil {
+			return err
+		}
+	}
+
+	c.refresh()
+	return nil
+}
+
+// Toggle shows or hides the mail servers view.
+func (c *MailserversViewController) Toggle() error {
+	if err := c.vm.ToggleView(c.viewName); err != nil {
+		return err
+	}
+	c.refresh()
+	return nil
+}
+
+// Selected returns the selected mail server.
+// If none is selected, the first one is returned.
+func (c *MailserversViewController) Selected() (*mailserver, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	for _, m := range c.mailservers {
+		if m.ID == c.selected {
+			return m, true
+		}
+	}
+	if len(c.mailservers) > 0 {
+		return c.mailservers[0], true
+	}
+	return nil, false
+}
+
+// FindMailserver looks up a mail server by its ID, a unique ID prefix or enode.
+func (c *MailserversViewController) FindMailserver(id string) (*mailserver, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	var found *mailserver
+	for _, m := range c.mailservers {
+		if m.ID == id || m.Enode == id {
+			return m, nil
+		}
+		if strings.HasPrefix(m.ID, id) {
+			if found != nil {
+				return nil, fmt.Errorf("mail server ID %s is ambiguous", id)
+			}
+			found = m
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("mail server %s not found", id)
+	}
+	return found, nil
+}
+
+// Add adds a new mail server.
+func (c *MailserversViewController) Add(enodeURL string) error {
+	m, err := newMailserver(enodeURL)
+	if err != nil {
+		return err
+	}
+	if err := c.messenger.AddMailserver(enodeURL); err != nil && err != protocol.ErrNotImplemented {
+		return err
+	}
+
+	c.Lock()
+	for _, existing := range c.mailservers {
+		if existing.ID == m.ID {
+			c.Unlock()
+			return fmt.Errorf("mail server %s already exists", m.ID)
+		}
+	}
+	c.mailservers = append(c.mailservers, m)
+	c.Unlock()
+
+	return c.save()
+}
+
+// Remove removes the mail server.
+func (c *MailserversViewController) Remove(m *mailserver) error {
+	if err := c.messenger.RemoveMailserver(m.ID); err != nil && err != protocol.ErrNotImplemented {
+		return err
+	}
+
+	c.Lock()
+	var mailservers []*mailserver
+	for _, existing := range c.mailservers {
+		if existing.ID != m.ID {
+			mailservers = append(mailservers, existing)
+		}
+	}
+	c.mailservers = mailservers
+	if c.selected == m.ID {
+		c.selected = ""
+	}
+	c.Unlock()
+
+	return c.save()
+}
+
+// Select makes the mail server used for requests and connects to it.
+func (c *MailserversViewController) Select(m *mailserver) error {
+	if err := c.messenger.SelectMailserver(m.ID); err != nil && err != protocol.ErrNotImplemented {
+		return err
+	}
+	if err := c.addPeer(m.Enode); err != nil {
+		return err
+	}
+
+	c.Lock()
+	c.selected = m.ID
+	c.Unlock()
+
+	return c.save()
+}
+
+func (c *MailserversViewController) save() error {
+	c.Lock()
+	config := mailserversConfig{Selected: c.selected}
+	for _, m := range c.mailservers {
+		config.Mailservers = append(config.Mailservers, m.Enode)
+	}
+	c.Unlock()
+
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(c.path, data, 0644); err != nil {
+		return err
+	}
+
+	c.refresh()
+	return nil
+}
+
+// refresh repaints the current list of mail servers.
+func (c *MailserversViewController) refresh() {
+	selected, _ := c.Selected()
+
+	c.Lock()
+	mailservers := c.mailservers
+	c.Unlock()
+
+	theme := c.vm.Theme()
+
+	c.g.Update(func(*gocui.Gui) error {
+		// The view exists only if it's enabled.
+		if _, err := c.view(); err != nil {
+			return nil
+		}
+		if err := c.Clear(); err != nil {
+			return err
+		}
+		for _, m := range mailservers {
+			isSelected := m == selected
+			line := mailserverToString(m, isSelected)
+			if isSelected {
+				line = styled(line, theme.Highlight)
+			}
+			if _, err := fmt.Fprintln(c.ViewController, line); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// mailserverRequestTimeout is a maximum time a single page
+// of historic messages can be requested. After that, the request
+// is considered expired even if no expired signal was received.
+const mailserverRequestTimeout = 30 * time.Second
+
+// historyPage is a result of a request for a page of historic messages.
+type historyPage struct {
+	cursor []byte
+	err    error
+}
+
+// RequestHistory requests historic messages for all chats from the mail server.
+// It follows cursors until all pages are received. progress is called
+// after each page. It returns a number of requested pages.
+func (c *MailserversViewController) RequestHistory(ctx context.Context, m *mailserver, from, to time.Time, progress func(page int)) (int, error) {
+	c.addRequests(1)
+	defer c.addRequests(-1)
+
+	c.requestLock.Lock()
+	defer c.requestLock.Unlock()
+
+	var (
+		cursor []byte
+		pages  int
+	)
+
+	for {
+		page := c.requestPage(ctx, m, from, to, cursor)
+		if page.err != nil {
+			return pages, page.err
+		}
+
+		pages++
+		c.logger.Info("received page of historic messages", zap.Int("page", pages), zap.Binary("cursor", page.cursor))
+		progress(pages)
+
+		if len(page.cursor) == 0 {
+			return pages, nil
+		}
+		cursor = page.cursor
+	}
+}
+
+// requestPage requests a single page of historic messages.
+//
+// The request is tracked with signals by its ID taken from the sent signal.
+// The result of RequestHistoricMessages is a fallback used
+// if signals are not available, e.g. with Nimbus, or were missed.
+func (c *MailserversViewController) requestPage(ctx context.Context, m *mailserver, from, to time.Time, cursor []byte) historyPage {
+	ctx, cancel := context.WithTimeout(ctx, mailserverRequestTimeout)
+	defer cancel()
+
+	sent, cancelSent := c.signals.FilterSent(m.ID)
+	defer cancelSent()
+
+	result := make(chan historyPage, 1)
+	go func() {
+		next, err := c.messenger.RequestHistoricMessages(ctx, m.PeerID(), uint32(from.Unix()), uint32(to.Unix()), cursor)
+		result <- historyPage{cursor: next, err: err}
+	}()
+
+	var (
+		signals       <-chan mailTypeSignal
+		cancelSignals = func() {}
+	)
+	defer func() { cancelSignals() }()
+
+	for {
+		select {
+		case sig := <-sent:
+			c.logger.Debug("history request sent", zap.String("id", sig.RequestID))
+			cancelSignals()
+			signals, cancelSignals = c.signals.Filter(sig.RequestID)
+		case sig := <-signals:
+			switch sig.Type {
+			case types.EventMailServerRequestCompleted:
+				return historyPage{cursor: sig.Cursor, err: sig.Error}
+			case types.EventMailServerRequestExpired:
+				return historyPage{err: fmt.Errorf("request to mail server %s expired", m.ID[:16])}
+			}
+		case page := <-result:
+			if page.err == context.DeadlineExceeded {
+				page.err = fmt.Errorf("request to mail server %s expired", m.ID[:16])
+			}
+			return page
+		}
+	}
+}
@@ -15,7 +15,6 @@ import (
 	"syscall"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/jroimartin/gocui"
 	"github.com/peterbourgon/ff"
 	"github.com/pkg/errors"
@@ -27,12 +26,18 @@ import (
 	"github.com/status-im/status-go/logutils"
 	"github.com/status-im/status-go/params"
 	"github.com/status-im/status-go/protocol"
+	"github.com/status-im/status-go/protocol/encryption/multidevice"
+	"github.com/status-im/status-go/protocol/identity/alias"
+	transport "github.com/status-im/status-go/protocol/transport/whisper"
 	"github.com/status-im/status-go/protocol/zaputil"
 	"github.com/status-im/status-go/signal"
 )
 
 var g *gocui.Gui
 
+// outputMode is a colour mode of the terminal.
+const outputMode = gocui.Output256
+
 var (
 	fs       = flag.NewFlagSet("status-term-client", flag.ExitOnError)
 	logLevel = fs.String("log-level", "INFO", "log level")
@@ -45,12 +50,24 @@ var (
 
 	// flags for in-proc node
 	dataDir        = fs.String("data-dir", filepath.Join(os.TempDir(), "status-term-client"), "data directory for Ethereum node")
-	installationID = fs.String("installation-id", uuid.New().String(), "the installationID to be used")
+	installationID = fs.String("installation-id", "", "the installationID to be used (by default, it's generated once and kept in the data dir)")
 	noNamespace    = fs.Bool("no-namespace", false, "disable data dir namespacing with public key")
 	fleet          = fs.String("fleet", params.FleetStaging, fmt.Sprintf("Status nodes cluster to connect to: %s", []string{params.FleetBeta, params.FleetStaging}))
 	configFile     = fs.String("node-config", "", "a JSON file with node config")
 	listenAddr     = fs.String("listen-addr", ":30303", "The address the Ethereum node should be listening to")
 	datasync       = fs.Bool("datasync", false, "enable datasync")
+	keymapFlag     = fs.String("keymap", "", "a JSON file with key bindings (by default, keymap.json in the data dir is used if it exists)")
+	themeFlag      = fs.String("theme", "", fmt.Sprintf("a built-in theme %s or a JSON theme file (by default, theme.json in the data dir is used if it exists)", []string{ThemeDark, ThemeLight, ThemeMonochrome}))
+	keymapPreset   = fs.String("keymap-preset", "", fmt.Sprintf("key bindings preset overriding the one from the keymap file: %s", []string{KeymapPresetDefault, KeymapPresetVi}))
+
+	pollInterval            = fs.Duration("poll-interval", 10*time.Second, "how often messages are retrieved if no new messages are signaled")
+	chatCapacity            = fs.Int("chat-capacity", defaultChatCapacity, "maximum number of messages of a chat kept in memory")
+	mailserverConfirmations = fs.Bool("mailserver-confirmations", false, "report sent messages confirmed when a mail server received them")
+
+	// flags for mentions
+	ensName  = fs.String("ens-name", "", "an ENS name which mentions us besides the alias")
+	keywords = fs.String("keywords", "", "comma-separated keywords which mention us; /expr/ is a regular expression")
+	bell     = fs.Bool("bell", false, "ring the terminal bell when we are mentioned")
 
 	// flags for external node
 	providerURI = fs.String("provider", "", "an URI pointing at a provider")
@@ -107,6 +124,36 @@ func main() {
 		fmt.Printf("Starting in %s\n", *dataDir)
 	}
 
+	if *installationID == "" {
+		id, err := loadOrCreateInstallationID(*dataDir)
+		if err != nil {
+			exitErr(errors.Wrap(err, "failed to load installation ID"))
+		}
+		*installationID = id
+	}
+
+	keymapPath, keymapOptional := *keymapFlag, false
+	if keymapPath == "" {
+		keymapPath, keymapOptional = filepath.Join(*dataDir, keymapFile), true
+	}
+	keymap, err := LoadKeymap(keymapPath, keymapOptional, *keymapPreset)
+	if err != nil {
+		exitErr(errors.Wrap(err, "failed to load keymap"))
+	}
+
+	themeName := *themeFlag
+	if themeName == "" {
+		themeName = ThemeDark
+		path := filepath.Join(*dataDir, themeFile)
+		if _, err := os.Stat(path); err == nil {
+			themeName = path
+		}
+	}
+	theme, err := LoadTheme(themeName)
+	if err != nil {
+		exitErr(errors.Wrap(err, "failed to load theme"))
+	}
+
 	// Setup logging by splitting it into a client.log
 	// with status-console-client logs and status.log
 	// with Status Node logs.
@@ -142,9 +189,23 @@ func main() {
 	// initialize protocol
 	var (
 		messenger *protocol.Messenger
+		node      types.Node
 		stopFunc  func()
 	)
 
+	// TODO: provide Mail Servers in a different way.
+	nodeConfig, err := generateStatusNodeConfig(*dataDir, *fleet, *listenAddr, *configFile)
+	if err != nil {
+		exitErr(errors.Wrap(err, "failed to generate node config"))
+	}
+
+	envelopesHandler := newEnvelopeEventsHandler()
+
+	// collect mail server request, peers and new messages signals
+	signalsForwarder := newSignalForwarder()
+	go signalsForwarder.Start()
+	newInstallations := make(chan []*multidevice.Installation, 10)
+
 	if *providerURI != "" {
 		messenger, err = createMessengerWithURI(*providerURI)
 		if err != nil {
@@ -152,7 +213,7 @@ func main() {
 		}
 	} else {
 		messengerDBPath := filepath.Join(*dataDir, "messenger.sql")
-		messenger, stopFunc, err = createMessengerInProc(privateKey, messengerDBPath, logger)
+		messenger, node, stopFunc, err = createMessengerInProc(privateKey, nodeConfig, signalsForwarder, messengerDBPath, envelopesHandler, newInstallations, logger)
 		if err != nil {
 			exitErr(err)
 		}
@@ -180,7 +241,7 @@ func main() {
 		exitErr(errors.New("exit with signal"))
 	}()
 
-	if err := setupGUI(privateKey, messenger, logger); err != nil {
+	if err := setupGUI(privateKey, messenger, node, nodeConfig.ClusterConfig.TrustedMailServers, signalsForwarder, envelopesHandler, newInstallations, keymap, theme, logger); err != nil {
 		exitErr(err)
 	}
 
@@ -213,14 +274,21 @@ func (k keysGetter) PrivateKey() (*ecdsa.PrivateKey, error) {
 	return k.privateKey, nil
 }
 
-func createMessengerInProc(pk *ecdsa.PrivateKey, dbPath string, logger *zap.Logger) (*protocol.Messenger, func(), error) {
-	// collect mail server request signals
-	signalsForwarder := newSignalForwarder()
-	go signalsForwarder.Start()
-
+func createMessengerInProc(
+	pk *ecdsa.PrivateKey,
+	nodeConfig *params.NodeConfig,
+	signalsForwarder *signalForwarder,
+	dbPath string,
+	envelopesHandler *envelopeEventsHandler,
+	newInstallations chan<- []*multidevice.Installation,
+	logger *zap.Logger,
+) (*protocol.Messenger, types.Node, func(), error) {
 	// setup signals handler
 	signal.SetDefaultNodeNotificationHandler(
-		filterMailTypesHandler(signalsForwarder.in),
+		multiSignalHandler(
+			filterPeersHandler(signalsForwarder.peers),
+			filterNewMessagesHandler(signalsForwarder.newMessages),
+		),
 	)
 
 	var (
@@ -241,10 +309,34 @@ func createMessengerInProc(pk *ecdsa.PrivateKey, dbPath string, logger *zap.Logg
 		stopFunc = func() {}
 	}
 
+	isMailserver := isMailserverFunc(nodeConfig.ClusterConfig.TrustedMailServers)
+
+	if *mailserverConfirmations {
+		// Envelopes posted by the messenger are tracked by the handler.
+		if node, err = envelopesHandler.TrackConfirmations(node, isMailserver, logger); err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to track mail server confirmations")
+		}
+	}
+
 	options := []protocol.Option{
 		protocol.WithCustomLogger(logger),
 		protocol.WithDatabaseConfig(dbPath, ""),
 		protocol.WithMessagesPersistenceEnabled(),
+		protocol.WithEnvelopesMonitorConfig(&transport.EnvelopesMonitorConfig{
+			EnvelopeEventsHandler:          envelopesHandler,
+			MaxAttempts:                    maxMessageDeliveryAttempts,
+			MailserverConfirmationsEnabled: false,
+			IsMailserver:                   isMailserver,
+			Logger:                         logger,
+		}),
+		protocol.WithOnNewInstallationsHandler(func(installations []*multidevice.Installation) {
+			// Do not block the protocol if nobody reads the installations.
+			select {
+			case newInstallations <- installations:
+			default:
+				logger.Warn("dropped new installations", zap.Int("count", len(installations)))
+			}
+		}),
 	}
 
 	if *datasync {
@@ -258,111 +350,407 @@ func createMessengerInProc(pk *ecdsa.PrivateKey, dbPath string, logger *zap.Logg
 		options...,
 	)
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "failed to create Messenger")
+		return nil, nil, nil, errors.Wrap(err, "failed to create Messenger")
 	}
 
 	if err := messenger.Init(); err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
 	// protocolGethService.SetMessenger(messenger)
 
-	return messenger, stopFunc, nil
+	return messenger, node, stopFunc, nil
 }
 
-func setupGUI(privateKey *ecdsa.PrivateKey, messenger *protocol.Messenger, logger *zap.Logger) error {
+func setupGUI(
+	privateKey *ecdsa.PrivateKey,
+	messenger *protocol.Messenger,
+	node types.Node,
+	trustedMailservers []string,
+	signalsForwarder *signalForwarder,
+	envelopesHandler *envelopeEventsHandler,
+	newInstallations <-chan []*multidevice.Installation,
+	keymap *Keymap,
+	theme *Theme,
+	logger *zap.Logger,
+) error {
 	var err error
 
 	// global
-	g, err = gocui.NewGui(gocui.Output256)
+	g, err = gocui.NewGui(outputMode)
 	if err != nil {
 		return err
 	}
 
 	// prepare views
-	vm := NewViewManager(nil, g, logger)
+	vm := NewViewManager(nil, g, theme, logger)
 
-	notifications := NewNotificationViewController(&ViewController{vm, g, ViewNotification})
+	notifications := NewNotificationViewController(&ViewController{vm, g, ViewNotification}, ViewToast, logger)
 
-	chatsVC := NewChatsViewController(&ViewController{vm, g, ViewChats}, messenger, logger)
+	chatsVC := NewChatsViewController(&ViewController{vm, g, ViewChats}, privateKey, messenger, logger)
 	if err := chatsVC.LoadAndRefresh(); err != nil {
 		return errors.Wrap(err, "failed to load chats")
 	}
 
+	contactsVC := NewContactsViewController(&ViewController{vm, g, ViewContacts}, messenger, logger)
+	contactsVC.LoadAndRefresh()
+
+	devicesVC := NewDevicesViewController(&ViewController{vm, g, ViewDevices}, messenger, *installationID, logger)
+	if err := devicesVC.LoadAndRefresh(); err != nil {
+		return errors.Wrap(err, "failed to load installations")
+	}
+
+	mailserversVC := NewMailserversViewController(&ViewController{vm, g, ViewMailservers}, messenger, signalsForwarder, node.AddPeer, *dataDir, logger)
+	if err := mailserversVC.Load(trustedMailservers); err != nil {
+		return errors.Wrap(err, "failed to load mail servers")
+	}
+
 	messagesVC := NewMessagesViewController(
 		&ViewController{vm, g, ViewChat},
 		privateKey,
 		messenger,
+		*pollInterval,
+		*chatCapacity,
+		notifications,
 		logger,
 		func() {
 			if err := chatsVC.LoadAndRefresh(); err != nil {
 				logger.Error("failed to load and refresh chats", zap.Error(err))
 			}
 		},
-		func(err error) {
-			_ = notifications.Error("Chat error", fmt.Sprintf("%v", err))
-		},
 	)
+	var keywordsList []string
+	if *keywords != "" {
+		keywordsList = strings.Split(*keywords, ",")
+	}
+	messagesVC.TrackSend(envelopesHandler.TrackSend)
+	mentions, err := newMentionMatcherForKey(messagesVC.myPubkeyString, *ensName, keywordsList)
+	if err != nil {
+		return errors.Wrap(err, "failed to setup mentions")
+	}
+	messagesVC.WatchMentions(mentions, *bell, chatsVC.MarkMentions)
+
+	inputHistory := NewInputHistory(*dataDir, logger)
+	if err := inputHistory.Load(); err != nil {
+		return errors.Wrap(err, "failed to load input history")
+	}
+	messagesVC.OnChatChanged(func(previous, next *protocol.Chat) error {
+		v, err := vm.RawView(ViewInput)
+		if err != nil {
+			return err
+		}
+		var previousID string
+		if previous != nil {
+			previousID = previous.ID
+		}
+		return inputHistory.SwitchChat(v, previousID, next.ID)
+	})
+
+	identity, err := alias.GenerateFromPublicKeyString(messagesVC.myPubkeyString)
+	if err != nil {
+		return errors.Wrap(err, "failed to generate alias")
+	}
+	if *ensName != "" {
+		identity += " (" + *ensName + ")"
+	}
+	statusBar := NewStatusBarViewController(&ViewController{vm, g, ViewStatusBar}, mailserversVC, identity, *fleet, *datasync, logger)
+	messagesVC.OnRetrieved(statusBar.SetRetrieved)
+	messagesVC.OnPendingChanged(statusBar.SetPending)
+	chatsVC.OnUnreadChanged(statusBar.SetUnread)
+	mailserversVC.OnRequestsChanged(statusBar.SetRequests)
+
 	err = messagesVC.Start()
 	if err != nil {
 		return err
 	}
 
-	inputMultiplexer := NewInputMultiplexer()
-	inputMultiplexer.AddHandler(DefaultMultiplexerPrefix, func(b []byte) error {
+	// Peers are displayed in the status bar and watched by the backfiller.
+	peers := make(chan []string, 10)
+	go func() {
+		for ids := range signalsForwarder.Peers() {
+			statusBar.SetPeers(ids)
+			peers <- ids
+		}
+	}()
+
+	backfiller := NewHistoryBackfiller(messenger, mailserversVC, *dataDir, logger, chatsVC.MarkGaps)
+	if err := backfiller.Start(peers); err != nil {
+		return errors.Wrap(err, "failed to start history backfill")
+	}
+
+	// Retrieve messages as soon as the node receives them.
+	go func() {
+		for range signalsForwarder.NewMessages() {
+			messagesVC.TriggerRetrieval()
+		}
+	}()
+	// Nimbus does not support envelope events yet
+	// so messages are only polled and mail server requests
+	// are tracked only by their results.
+	if node != nil && !*useNimbus {
+		w, err := node.GetWhisper(nil)
+		if err != nil {
+			return errors.Wrap(err, "failed to get Whisper")
+		}
+		forwardAvailableEnvelopes(w, signalsForwarder.newMessages)
+		forwardMailServerRequests(w, signalsForwarder.in)
+	}
+
+	go func() {
+		for event := range envelopesHandler.Events() {
+			messagesVC.UpdateOutgoingStatus(event.MessageIDs, event.Status)
+		}
+	}()
+
+	go func() {
+		for installations := range newInstallations {
+			for _, i := range installations {
+				logger.Info("new installation", zap.String("id", i.ID))
+				message := fmt.Sprintf("New device paired with our key: %s", installationToString(i, false))
+				notifications.Info("New device", message)
+			}
+			if err := devicesVC.LoadAndRefresh(); err != nil {
+				logger.Error("failed to load installations", zap.Error(err))
+			}
+		}
+	}()
+
+	inputMultiplexer := NewInputMultiplexer(notifications)
+	inputMultiplexer.SetDefaultHandler(func(b []byte) error {
 		logger.Info("default multiplexer handler")
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 		response, err := messagesVC.Send(ctx, string(b))
+		if err != nil {
+			// The error is already reported in the notification view
+			// and the message can be resent.
+			logger.Error("failed to send message", zap.Error(err))
+			return nil
+		}
 		logger.Info("SENT MESSAGE", zap.Any("RESPOSNE", response))
+		return nil
+	})
+	inputMultiplexer.AddCommand(ChatCmdFactory(chatsVC, messagesVC))
+	inputMultiplexer.AddCommand(GroupCmdFactory(chatsVC, messagesVC, notifications))
+	inputMultiplexer.AddCommand(ResendCmdFactory(messagesVC))
+	inputMultiplexer.AddCommand(ContactCmdFactory(contactsVC, chatsVC, messagesVC))
+	inputMultiplexer.AddCommand(DevicesCmdFactory(devicesVC))
+	inputMultiplexer.AddCommand(MailserverCmdFactory(mailserversVC))
+	inputMultiplexer.AddCommand(RequestCmdFactory(mailserversVC, chatsVC, messagesVC, notifications))
+	inputMultiplexer.AddCommand(SyncCmdFactory(backfiller, notifications))
+	inputMultiplexer.AddCommand(StickerCmdFactory(messagesVC))
+	inputMultiplexer.AddCommand(EmojiCmdFactory(messagesVC))
+
+	composer := NewComposer(g, outputMode, messagesVC, notifications, func(text string) error {
+		inputHistory.Add(text)
+		return inputMultiplexer.Handle([]byte(text))
+	}, logger)
+	inputMultiplexer.AddCommand(ComposeCmdFactory(g, composer))
+
+	helpVC := NewHelpViewController(&ViewController{vm, g, ViewHelp})
+	inputMultiplexer.AddCommand(HelpCmdFactory(inputMultiplexer, helpVC))
+
+	completer := NewCompleter(&ViewController{vm, g, ViewCompletion}, inputMultiplexer, chatsVC, contactsVC, messagesVC, logger)
+
+	actions := NewActionTable()
+	actions.Add(ActionQuit, func(g *gocui.Gui, v *gocui.View) error {
+		if input, err := vm.RawView(ViewInput); err == nil {
+			inputHistory.SaveDraft(input)
+		}
+		return QuitHandler(g, v)
+	})
+	actions.Add(ActionNextView, NextViewHandler(vm))
+	actions.Add(ActionCursorDown, CursorDownHandler)
+	actions.Add(ActionCursorUp, CursorUpHandler)
+	actions.Add(ActionHome, HomeHandler)
+	actions.Add(ActionEnd, EndHandler)
+	actions.Add(ActionToggleContacts, func(g *gocui.Gui, v *gocui.View) error {
+		return contactsVC.Toggle()
+	})
+	actions.Add(ActionToggleDevices, func(g *gocui.Gui, v *gocui.View) error {
+		return devicesVC.Toggle()
+	})
+	actions.Add(ActionToggleMailservers, func(g *gocui.Gui, v *gocui.View) error {
+		return mailserversVC.Toggle()
+	})
+	actions.AddForView(ActionSelectChat, ViewChats, GetLineHandler(func(idx int, _ string) error {
+		selectedChat, ok := chatsVC.ChatByIdx(idx)
+		if !ok {
+			return errors.New("chat could not be found")
+		}
+
+		// We need to call Select asynchronously,
+		// otherwise the main thread is blocked
+		// and nothing is rendered.
+		go func() {
+			messagesVC.Select(selectedChat)
+		}()
+
+		return nil
+	}))
+	actions.AddForView(ActionCursorDown, ViewChat, func(g *gocui.Gui, v *gocui.View) error {
+		if err := CursorDownHandler(g, v); err != nil {
+			return err
+		}
+		messagesVC.MarkSeenIfAtBottom(v)
+		return nil
+	})
+	actions.AddForView(ActionCursorUp, ViewChat, CursorUpOrLoadHandler(func() {
+		// Load asynchronously to not block the main thread.
+		go func() {
+			if err := messagesVC.LoadMore(); err != nil {
+				logger.Error("failed to load more messages", zap.Error(err))
+			}
+		}()
+	}))
+	actions.AddForView(ActionEnd, ViewChat, func(g *gocui.Gui, v *gocui.View) error {
+		if err := EndHandler(g, v); err != nil {
+			return err
+		}
+		messagesVC.MarkSeenIfAtBottom(v)
+		return nil
+	})
+	actions.AddForView(ActionReply, ViewChat, func(g *gocui.Gui, v *gocui.View) error {
+		message, ok := messagesVC.MessageAtCursor(v)
+		if !ok {
+			return nil
+		}
+		messagesVC.ReplyTo(message)
+		_, err := vm.SelectView(ViewInput)
 		return err
 	})
-	inputMultiplexer.AddHandler("/chat", ChatCmdFactory(chatsVC, messagesVC))
-	// inputMultiplexer.AddHandler("/request", RequestCmdFactory(chatVC))
+	actions.AddForView(ActionResend, ViewChat, func(g *gocui.Gui, v *gocui.View) error {
+		message, ok := messagesVC.MessageAtCursor(v)
+		if !ok {
+			return nil
+		}
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), resendCmdTimeout)
+			defer cancel()
+			// errors are reported by the controller
+			_ = messagesVC.Resend(ctx, message)
+		}()
+		return nil
+	})
+	actions.AddForView(ActionToggleMarkdown, ViewChat, func(g *gocui.Gui, v *gocui.View) error {
+		messagesVC.ToggleMarkdown()
+		return nil
+	})
+	actions.AddForView(ActionSubmit, ViewInput, func(g *gocui.Gui, v *gocui.View) error {
+		if err := completer.Reset(); err != nil {
+			return err
+		}
+		inputHistory.Add(v.Buffer())
+		return inputMultiplexer.BindingHandler(g, v)
+	})
+	actions.AddForView(ActionHistoryPrevious, ViewInput, func(g *gocui.Gui, v *gocui.View) error {
+		if err := completer.Reset(); err != nil {
+			return err
+		}
+		return inputHistory.Previous(v)
+	})
+	actions.AddForView(ActionCompose, ViewInput, func(g *gocui.Gui, v *gocui.View) error {
+		if err := completer.Reset(); err != nil {
+			return err
+		}
+		return composer.Compose(v, inputText(v))
+	})
+	actions.AddForView(ActionHistoryNext, ViewInput, func(g *gocui.Gui, v *gocui.View) error {
+		if err := completer.Reset(); err != nil {
+			return err
+		}
+		return inputHistory.Next(v)
+	})
+	actions.AddForView(ActionNewline, ViewInput, MoveToNewLineHandler)
+	actions.AddForView(ActionCancelReply, ViewInput, func(g *gocui.Gui, v *gocui.View) error {
+		messagesVC.CancelReply()
+		return completer.Reset()
+	})
+	actions.AddForView(ActionComplete, ViewInput, func(g *gocui.Gui, v *gocui.View) error {
+		// Tab in the empty input moves to the next view.
+		if ok, err := completer.Complete(v); ok || err != nil {
+			return err
+		}
+		return vm.NextView()
+	})
+	actions.Add(ActionToggleNotifications, func(g *gocui.Gui, v *gocui.View) error {
+		return notifications.Toggle()
+	})
+	actions.AddForView(ActionDismissNotification, ViewNotification, func(g *gocui.Gui, v *gocui.View) error {
+		return notifications.Toggle()
+	})
+	actions.AddForView(ActionCloseHelp, ViewHelp, func(g *gocui.Gui, v *gocui.View) error {
+		return helpVC.Close()
+	})
+
+	switcher := NewQuickSwitcher(&ViewController{vm, g, ViewSwitcher}, ViewSwitcherResults, chatsVC, contactsVC, messagesVC, logger)
+	actions.Add(ActionQuickSwitch, func(g *gocui.Gui, v *gocui.View) error {
+		if err := completer.Reset(); err != nil {
+			return err
+		}
+		return switcher.Toggle()
+	})
+	actions.AddForView(ActionCursorDown, ViewSwitcher, func(g *gocui.Gui, v *gocui.View) error {
+		return switcher.Move(1)
+	})
+	actions.AddForView(ActionCursorUp, ViewSwitcher, func(g *gocui.Gui, v *gocui.View) error {
+		return switcher.Move(-1)
+	})
+	actions.AddForView(ActionSelectChat, ViewSwitcher, func(g *gocui.Gui, v *gocui.View) error {
+		return switcher.Select()
+	})
+	actions.AddForView(ActionCloseSwitcher, ViewSwitcher, func(g *gocui.Gui, v *gocui.View) error {
+		return switcher.Close()
+	})
+
+	var inputEditor gocui.Editor = gocui.DefaultEditor
+	if keymap.Preset == KeymapPresetVi {
+		editor := &modalEditor{}
+		inputEditor = editor
+		actions.AddForView(ActionNormalMode, ViewInput, func(g *gocui.Gui, v *gocui.View) error {
+			// Esc in the normal mode cancels the reply.
+			if !editor.NormalMode() {
+				messagesVC.CancelReply()
+			}
+			return completer.Reset()
+		})
+	}
+	// Editing the input discards completion candidates.
+	inputEditor = &completionEditor{editor: inputEditor, completer: completer}
+
+	keybindings := make(map[string][]Binding)
+	for _, name := range []string{"", ViewChats, ViewChat, ViewInput, ViewContacts, ViewDevices, ViewMailservers, ViewNotification, ViewHelp, ViewSwitcher} {
+		bindings, err := keymap.Bindings(name, actions)
+		if err != nil {
+			return err
+		}
+		keybindings[name] = bindings
+	}
 
 	views := []*View{
+		{
+			// The status bar is a single line above other views.
+			Name:      ViewStatusBar,
+			Enabled:   true,
+			Frameless: true,
+			Passive:   true,
+			TopLeft:   func(maxX, maxY int) (int, int) { return -1, -1 },
+			BottomRight: func(maxX, maxY int) (int, int) {
+				return maxX, 1
+			},
+		},
 		{
 			Name:       ViewChats,
 			Enabled:    true,
 			Cursor:     true,
 			Highlight:  true,
-			SelBgColor: gocui.ColorGreen,
-			SelFgColor: gocui.ColorBlack,
-			TopLeft:    func(maxX, maxY int) (int, int) { return 0, 0 },
+			SelBgColor: theme.SelectionBg,
+			SelFgColor: theme.SelectionFg,
+			TopLeft:    func(maxX, maxY int) (int, int) { return 0, 1 },
 			BottomRight: func(maxX, maxY int) (int, int) {
 				return int(math.Floor(float64(maxX) * 0.2)), maxY - 4
 			},
-			Keybindings: []Binding{
-				{
-					Key:     gocui.KeyArrowDown,
-					Mod:     gocui.ModNone,
-					Handler: CursorDownHandler,
-				},
-				{
-					Key:     gocui.KeyArrowUp,
-					Mod:     gocui.ModNone,
-					Handler: CursorUpHandler,
-				},
-				{
-					Key: gocui.KeyEnter,
-					Mod: gocui.ModNone,
-					Handler: GetLineHandler(func(idx int, _ string) error {
-						selectedChat, ok := chatsVC.ChatByIdx(idx)
-						if !ok {
-							return errors.New("chat could not be found")
-						}
-
-						// We need to call Select asynchronously,
-						// otherwise the main thread is blocked
-						// and nothing is rendered.
-						go func() {
-							messagesVC.Select(selectedChat)
-						}()
-
-						return nil
-					}),
-				},
-			},
+			Keybindings: keybindings[ViewChats],
 		},
 		{
 			Name:       ViewChat,
@@ -371,38 +759,15 @@ func setupGUI(privateKey *ecdsa.PrivateKey, messenger *protocol.Messenger, logge
 			Autoscroll: false,
 			Highlight:  true,
 			Wrap:       true,
-			SelBgColor: gocui.ColorGreen,
-			SelFgColor: gocui.ColorBlack,
+			SelBgColor: theme.SelectionBg,
+			SelFgColor: theme.SelectionFg,
 			TopLeft: func(maxX, maxY int) (int, int) {
-				return int(math.Ceil(float64(maxX) * 0.2)), 0
+				return int(math.Ceil(float64(maxX) * 0.2)), 1
 			},
 			BottomRight: func(maxX, maxY int) (int, int) {
 				return maxX - 1, maxY - 4
 			},
-			Keybindings: []Binding{
-				{
-					Key:     gocui.KeyArrowDown,
-					Mod:     gocui.ModNone,
-					Handler: CursorDownHandler,
-				},
-				{
-					Key:     gocui.KeyArrowUp,
-					Mod:     gocui.ModNone,
-					Handler: CursorUpHandler,
-				},
-				{
-					Key: gocui.KeyHome,
-					Mod: gocui.ModNone,
-					Handler: func(g *gocui.Gui, v *gocui.View) error {
-						return HomeHandler(g, v)
-					},
-				},
-				{
-					Key:     gocui.KeyEnd,
-					Mod:     gocui.ModNone,
-					Handler: EndHandler,
-				},
-			},
+			Keybindings: keybindings[ViewChat],
 		},
 		{
 			Name: ViewInput,
@@ -415,69 +780,142 @@ func setupGUI(privateKey *ecdsa.PrivateKey, messenger *protocol.Messenger, logge
 			Editable:  true,
 			Cursor:    true,
 			Highlight: true,
+			Editor:    inputEditor,
 			TopLeft: func(maxX, maxY int) (int, int) {
 				return 0, maxY - 3
 			},
 			BottomRight: func(maxX, maxY int) (int, int) {
 				return maxX - 1, maxY - 1
 			},
-			Keybindings: []Binding{
-				{
-					Key:     gocui.KeyEnter,
-					Mod:     gocui.ModNone,
-					Handler: inputMultiplexer.BindingHandler,
-				},
-				{
-					Key:     gocui.KeyEnter,
-					Mod:     gocui.ModAlt,
-					Handler: MoveToNewLineHandler,
-				},
+			Keybindings: keybindings[ViewInput],
+		},
+		{
+			Name:      ViewContacts,
+			Enabled:   false,
+			Cursor:    true,
+			Highlight: true,
+			Wrap:      true,
+			TopLeft: func(maxX, maxY int) (int, int) {
+				return maxX/2 - 60, 2
+			},
+			BottomRight: func(maxX, maxY int) (int, int) {
+				return maxX/2 + 60, maxY - 6
+			},
+			Keybindings: keybindings[ViewContacts],
+		},
+		{
+			Name:      ViewDevices,
+			Enabled:   false,
+			Cursor:    true,
+			Highlight: true,
+			Wrap:      true,
+			TopLeft: func(maxX, maxY int) (int, int) {
+				return maxX/2 - 60, 2
+			},
+			BottomRight: func(maxX, maxY int) (int, int) {
+				return maxX/2 + 60, maxY - 6
 			},
+			Keybindings: keybindings[ViewDevices],
+		},
+		{
+			Name:      ViewMailservers,
+			Enabled:   false,
+			Cursor:    true,
+			Highlight: true,
+			TopLeft: func(maxX, maxY int) (int, int) {
+				return maxX/2 - 40, 2
+			},
+			BottomRight: func(maxX, maxY int) (int, int) {
+				return maxX/2 + 40, maxY - 6
+			},
+			Keybindings: keybindings[ViewMailservers],
 		},
 		{
 			Name:      ViewNotification,
+			Title:     "notifications",
 			Enabled:   false,
-			Editable:  false,
-			Cursor:    false,
+			Cursor:    true,
 			Highlight: true,
 			TopLeft: func(maxX, maxY int) (int, int) {
-				return maxX/2 - 50, maxY / 2
+				return maxX/2 - 60, 2
 			},
 			BottomRight: func(maxX, maxY int) (int, int) {
-				return maxX/2 + 50, maxY/2 + 2
+				return maxX/2 + 60, maxY - 6
 			},
-			Keybindings: []Binding{
-				{
-					Key: gocui.KeyEnter,
-					Mod: gocui.ModNone,
-					Handler: func(g *gocui.Gui, v *gocui.View) error {
-						logger.Info("Notification Enter binding")
-
-						if err := vm.DisableView(ViewNotification); err != nil {
-							return err
-						}
-
-						if err := vm.DeleteView(ViewNotification); err != nil {
-							return err
-						}
-
-						return nil
-					},
-				},
+			Keybindings: keybindings[ViewNotification],
+		},
+		{
+			Name:    ViewHelp,
+			Enabled: false,
+			Cursor:  true,
+			TopLeft: func(maxX, maxY int) (int, int) {
+				return maxX/2 - 60, 2
+			},
+			BottomRight: func(maxX, maxY int) (int, int) {
+				return maxX/2 + 60, maxY - 6
 			},
+			Keybindings: keybindings[ViewHelp],
 		},
-	}
-
-	bindings := []Binding{
 		{
-			Key:     gocui.KeyCtrlC,
-			Mod:     gocui.ModNone,
-			Handler: QuitHandler,
+			// Toasts are displayed above the input view
+			// and grow with a number of notifications.
+			Name:    ViewToast,
+			Title:   "notifications",
+			Enabled: false,
+			TopLeft: func(maxX, maxY int) (int, int) {
+				return maxX / 2, maxY - 5 - notifications.ToastsCount()
+			},
+			BottomRight: func(maxX, maxY int) (int, int) {
+				return maxX - 1, maxY - 4
+			},
+		},
+		{
+			// Completion candidates are displayed above the completed word.
+			Name:       ViewCompletion,
+			Title:      "completions",
+			Enabled:    false,
+			Highlight:  true,
+			SelBgColor: theme.SelectionBg,
+			SelFgColor: theme.SelectionFg,
+			TopLeft: func(maxX, maxY int) (int, int) {
+				x0, y0, _, _ := completer.PopupBounds(maxX, maxY)
+				return x0, y0
+			},
+			BottomRight: func(maxX, maxY int) (int, int) {
+				_, _, x1, y1 := completer.PopupBounds(maxX, maxY)
+				return x1, y1
+			},
 		},
 		{
-			Key:     gocui.KeyTab,
-			Mod:     gocui.ModNone,
-			Handler: NextViewHandler(vm),
+			// The quick switcher query is displayed above found chats.
+			Name:     ViewSwitcher,
+			Title:    "switch to chat",
+			Enabled:  false,
+			Editable: true,
+			Cursor:   true,
+			Editor:   &switcherEditor{switcher: switcher},
+			TopLeft: func(maxX, maxY int) (int, int) {
+				return maxX/2 - 40, 2
+			},
+			BottomRight: func(maxX, maxY int) (int, int) {
+				return maxX/2 + 40, 4
+			},
+			Keybindings: keybindings[ViewSwitcher],
+		},
+		{
+			Name:       ViewSwitcherResults,
+			Title:      "chats",
+			Enabled:    false,
+			Highlight:  true,
+			Passive:    true,
+			SelBgColor: theme.SelectionBg,
+			SelFgColor: theme.SelectionFg,
+			TopLeft: func(maxX, maxY int) (int, int) {
+				return maxX/2 - 40, 5
+			},
+			BottomRight: func(maxX, maxY int) (int, int) {
+				return maxX/2 + 40, 6 + switcher.ResultsHeight()
+			},
 		},
 	}
 
@@ -485,7 +923,7 @@ func setupGUI(privateKey *ecdsa.PrivateKey, messenger *protocol.Messenger, logge
 		return err
 	}
 
-	if err := vm.SetGlobalKeybindings(bindings); err != nil {
+	if err := vm.SetGlobalKeybindings(keybindings[""]); err != nil {
 		return err
 	}
 
@@ -0,0 +1,296 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fatih/color"
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+
+	"github.com/status-im/status-go/protocol/protobuf"
+)
+
+// continuationIndent prefixes lines of a message
+// following the first one, including wrapped lines.
+const continuationIndent = "    "
+
+const sgrReset = "\x1b[0m"
+
+// sgr returns escape sequences setting the given attributes.
+// gocui supports only colours, bold, underline and reverse,
+// so other attributes are ignored by the view.
+//
+// gocui resets attributes when a foreground colour is set
+// and expects 256-colour sequences to be separate, so the
+// foreground colour goes first and the background one is set
+// by another sequence.
+func sgr(attrs []color.Attribute) string {
+	if len(attrs) == 0 || color.NoColor {
+		return ""
+	}
+
+	var fg, other, bg []string
+	for i := 0; i < len(attrs); i++ {
+		a := attrs[i]
+		switch {
+		case (a == 38 || a == 48) && i+2 < len(attrs) && attrs[i+1] == 5:
+			codes := []string{strconv.Itoa(int(a)), "5", strconv.Itoa(int(attrs[i+2]))}
+			if a == 38 {
+				fg = codes
+			} else {
+				bg = codes
+			}
+			i += 2
+		case a >= color.FgBlack && a <= color.FgWhite, a >= color.FgHiBlack && a <= color.FgHiWhite, a == 39:
+			fg = []string{strconv.Itoa(int(a))}
+		case a >= color.BgBlack && a <= color.BgWhite, a >= color.BgHiBlack && a <= color.BgHiWhite, a == 49:
+			bg = []string{strconv.Itoa(int(a))}
+		default:
+			other = append(other, strconv.Itoa(int(a)))
+		}
+	}
+
+	var seq string
+	if codes := append(fg, other...); len(codes) > 0 {
+		seq += "\x1b[" + strings.Join(codes, ";") + "m"
+	}
+	if len(bg) > 0 {
+		seq += "\x1b[" + strings.Join(bg, ";") + "m"
+	}
+	return seq
+}
+
+// markdownRenderer renders a markdown AST as lines of text
+// with ANSI escape sequences understood by gocui.
+//
+// gocui does not support resetting a single attribute
+// so after each styled span, the base style is restored.
+type markdownRenderer struct {
+	base  []color.Attribute
+	theme *Theme
+}
+
+// renderMarkdown parses the text as markdown and renders it.
+// Styled spans restore the base style which must be set
+// before writing the lines.
+//
+// Messages keep the parsed text as JSON in ParsedText
+// which can't be decoded back into AST nodes, so the text
+// is parsed again with the same parser.
+//
+// At least one line is always returned, even if the text
+// is empty or contains only whitespace.
+func renderMarkdown(text string, base []color.Attribute, theme *Theme) []string {
+	r := markdownRenderer{base: base, theme: theme}
+	doc := markdown.Parse([]byte(text), nil)
+	lines := r.renderBlocks(doc.GetChildren())
+	if len(lines) == 0 {
+		return []string{""}
+	}
+	return lines
+}
+
+// isMarkdownContent returns true if messages
+// of the content type are written in markdown.
+func isMarkdownContent(contentType protobuf.ChatMessage_ContentType) bool {
+	switch contentType {
+	case protobuf.ChatMessage_TEXT_PLAIN, protobuf.ChatMessage_STATUS, protobuf.ChatMessage_UNKNOWN_CONTENT_TYPE:
+		return true
+	default:
+		return false
+	}
+}
+
+// renderAsMarkdown returns true if messages of the content type
+// are rendered as markdown. If rawText is true, their text
+// is displayed as it was written.
+func renderAsMarkdown(contentType protobuf.ChatMessage_ContentType, rawText bool) bool {
+	return !rawText && isMarkdownContent(contentType)
+}
+
+// span returns the text styled with the attributes.
+func (r *markdownRenderer) span(text string, attrs ...color.Attribute) string {
+	return span(text, attrs, r.base)
+}
+
+func (r *markdownRenderer) renderBlocks(nodes []ast.Node) []string {
+	var lines []string
+	for _, node := range nodes {
+		lines = append(lines, r.renderBlock(node)...)
+	}
+	return lines
+}
+
+func (r *markdownRenderer) renderBlock(node ast.Node) []string {
+	switch n := node.(type) {
+	case *ast.Paragraph:
+		return strings.Split(r.renderInlines(n.Children), "\n")
+	case *ast.Heading:
+		return []string{r.span(r.renderInlines(n.Children), color.Bold, color.Underline)}
+	case *ast.BlockQuote:
+		var lines []string
+		if len(n.Children) > 0 {
+			lines = r.renderBlocks(n.Children)
+		} else {
+			lines = splitLiteral(n.Literal)
+		}
+		for i, line := range lines {
+			lines[i] = r.span("│ ", r.theme.Quote...) + line
+		}
+		return lines
+	case *ast.CodeBlock:
+		lines := splitLiteral(n.Literal)
+		for i, line := range lines {
+			lines[i] = "  " + r.span(line, r.theme.Code...)
+		}
+		return lines
+	case *ast.List:
+		return r.renderList(n)
+	case *ast.HorizontalRule:
+		return []string{"────────"}
+	default:
+		if children := node.GetChildren(); len(children) > 0 {
+			return r.renderBlocks(children)
+		}
+		return splitLiteral(literal(node))
+	}
+}
+
+func (r *markdownRenderer) renderList(list *ast.List) []string {
+	var lines []string
+	number := list.Start
+	if number == 0 {
+		number = 1
+	}
+	for _, item := range list.Children {
+		bullet := "• "
+		if list.ListFlags&ast.ListTypeOrdered != 0 {
+			bullet = fmt.Sprintf("%d. ", number)
+			number++
+		}
+		indent := strings.Repeat(" ", utf8.RuneCountInString(bullet))
+		for i, line := range r.renderBlocks(item.GetChildren()) {
+			if i == 0 {
+				lines = append(lines, bullet+line)
+			} else {
+				lines = append(lines, indent+line)
+			}
+		}
+	}
+	return lines
+}
+
+func (r *markdownRenderer) renderInlines(nodes []ast.Node) string {
+	var b strings.Builder
+	for _, node := range nodes {
+		b.WriteString(r.renderInline(node))
+	}
+	return b.String()
+}
+
+func (r *markdownRenderer) renderInline(node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.Text:
+		return string(n.Literal)
+	case *ast.Strong:
+		return r.span(r.inlineText(n), color.Bold)
+	case *ast.Emph:
+		// gocui does not support italic.
+		return r.span(r.inlineText(n), color.Underline)
+	case *ast.Del:
+		return "~" + r.inlineText(n) + "~"
+	case *ast.Code:
+		return r.span(string(n.Literal), r.theme.Code...)
+	case *ast.StatusTag:
+		return r.span("#"+string(n.Literal), color.Bold)
+	case *ast.Link:
+		text := r.inlineText(n)
+		link := r.span(text, r.theme.Link...)
+		if destination := string(n.Destination); destination != text {
+			link += " <" + destination + ">"
+		}
+		return link
+	case *ast.Image:
+		return "[image " + string(n.Destination) + "]"
+	case *ast.Hardbreak, *ast.Softbreak:
+		return "\n"
+	default:
+		return r.inlineText(node)
+	}
+}
+
+// inlineText returns a text of the node which can be
+// either a literal or its children depending on the parser.
+func (r *markdownRenderer) inlineText(node ast.Node) string {
+	if children := node.GetChildren(); len(children) > 0 {
+		return r.renderInlines(children)
+	}
+	return string(literal(node))
+}
+
+func literal(node ast.Node) []byte {
+	if leaf := node.AsLeaf(); leaf != nil {
+		return leaf.Literal
+	}
+	if container := node.AsContainer(); container != nil {
+		return container.Literal
+	}
+	return nil
+}
+
+func splitLiteral(literal []byte) []string {
+	return strings.Split(strings.TrimRight(string(literal), "\n"), "\n")
+}
+
+// visibleLength returns a number of runes
+// in the text without escape sequences.
+func visibleLength(text string) int {
+	n := 0
+	inEscape := false
+	for _, r := range text {
+		switch {
+		case inEscape:
+			if r == 'm' {
+				inEscape = false
+			}
+		case r == '\x1b':
+			inEscape = true
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// wrapLine breaks the line into lines not longer than width
+// and prefixes the following lines with the indent.
+// Escape sequences do not count into the width.
+// Words longer than the width are left to be wrapped by the view.
+func wrapLine(line string, width int, indent string) []string {
+	if width <= 0 || visibleLength(line) <= width {
+		return []string{line}
+	}
+
+	var (
+		lines   []string
+		current string
+		length  int
+	)
+	for i, word := range strings.Split(line, " ") {
+		wordLength := visibleLength(word)
+		switch {
+		case i == 0:
+			current, length = word, wordLength
+		case length+1+wordLength > width && length > len(indent):
+			lines = append(lines, current)
+			current, length = indent+word, len(indent)+wordLength
+		default:
+			current += " " + word
+			length += 1 + wordLength
+		}
+	}
+	return append(lines, current)
+}
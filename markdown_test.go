@@ -0,0 +1,327 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/fatih/color"
+	"github.com/gomarkdown/markdown/ast"
+
+	"github.com/status-im/status-go/protocol/protobuf"
+)
+
+// setColors sets whether escape sequences are written
+// and returns a function restoring the previous setting.
+func setColors(enabled bool) (restore func()) {
+	noColor := color.NoColor
+	color.NoColor = !enabled
+	return func() { color.NoColor = noColor }
+}
+
+func loadTestTheme(t *testing.T) *Theme {
+	theme, err := LoadTheme(ThemeDark)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return theme
+}
+
+// styledSpan returns the text as styled by the renderer without a base style.
+func styledSpan(text string, attrs ...color.Attribute) string {
+	return sgr(attrs) + text + sgrReset
+}
+
+func TestRenderMarkdownInlines(t *testing.T) {
+	defer setColors(true)()
+	theme := loadTestTheme(t)
+
+	testCases := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{
+			name:     "bold",
+			text:     "a **bold** word",
+			expected: []string{"a " + styledSpan("bold", color.Bold) + " word"},
+		},
+		{
+			name:     "italic",
+			text:     "an _italic_ word",
+			expected: []string{"an " + styledSpan("italic", color.Underline) + " word"},
+		},
+		{
+			name:     "bold and italic",
+			text:     "**bold** and *italic*",
+			expected: []string{styledSpan("bold", color.Bold) + " and " + styledSpan("italic", color.Underline)},
+		},
+		{
+			name:     "inline code",
+			text:     "run `make test` now",
+			expected: []string{"run " + styledSpan("make test", theme.Code...) + " now"},
+		},
+		{
+			name:     "inline code is not parsed",
+			text:     "`**not bold**`",
+			expected: []string{styledSpan("**not bold**", theme.Code...)},
+		},
+		{
+			name:     "link",
+			text:     "see https://status.im/docs",
+			expected: []string{"see " + styledSpan("https://status.im/docs", theme.Link...)},
+		},
+		{
+			name:     "status tag",
+			text:     "join #status",
+			expected: []string{"join " + styledSpan("#status", color.Bold)},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lines := renderMarkdown(tc.text, nil, theme)
+			if !reflect.DeepEqual(lines, tc.expected) {
+				t.Fatalf("expected %q, got %q", tc.expected, lines)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownBaseStyle(t *testing.T) {
+	defer setColors(true)()
+	theme := loadTestTheme(t)
+
+	base := []color.Attribute{color.FgGreen}
+	lines := renderMarkdown("a **bold** word", base, theme)
+	expected := []string{"a " + styledSpan("bold", color.Bold) + sgr(base) + " word"}
+	if !reflect.DeepEqual(lines, expected) {
+		t.Fatalf("expected %q, got %q", expected, lines)
+	}
+}
+
+func TestRenderMarkdownEmptyText(t *testing.T) {
+	theme := loadTestTheme(t)
+
+	testCases := []struct {
+		name string
+		text string
+	}{
+		{name: "empty", text: ""},
+		{name: "spaces", text: "   "},
+		{name: "newlines", text: "\n\n"},
+		{name: "mixed whitespace", text: " \t\n "},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lines := renderMarkdown(tc.text, nil, theme)
+			if len(lines) != 1 || lines[0] != "" {
+				t.Fatalf("expected a single empty line, got %q", lines)
+			}
+		})
+	}
+}
+
+func TestRenderMarkdownBlocks(t *testing.T) {
+	defer setColors(false)()
+	theme := loadTestTheme(t)
+
+	testCases := []struct {
+		name     string
+		text     string
+		expected []string
+	}{
+		{
+			name:     "paragraphs",
+			text:     "first\n\nsecond",
+			expected: []string{"first", "second"},
+		},
+		{
+			name:     "line breaks",
+			text:     "first\nsecond",
+			expected: []string{"first", "second"},
+		},
+		{
+			name:     "fenced code block",
+			text:     "```go\nfunc main() {\n\t**x**\n}\n```",
+			expected: []string{"  func main() {", "  \t**x**", "  }"},
+		},
+		{
+			name:     "block quote",
+			text:     "> quoted\n> text",
+			expected: []string{"│ quoted", "│ text"},
+		},
+		{
+			name:     "block quote is not parsed",
+			text:     "> quoted `code`",
+			expected: []string{"│ quoted `code`"},
+		},
+		{
+			// The protocol parser does not support lists
+			// so they are displayed as they were written.
+			name:     "list markers",
+			text:     "- one\n- two",
+			expected: []string{"- one", "- two"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lines := renderMarkdown(tc.text, nil, theme)
+			if !reflect.DeepEqual(lines, tc.expected) {
+				t.Fatalf("expected %q, got %q", tc.expected, lines)
+			}
+		})
+	}
+}
+
+// textNode returns a paragraph with the text.
+func textNode(text string) ast.Node {
+	p := &ast.Paragraph{}
+	ast.AppendChild(p, &ast.Text{Leaf: ast.Leaf{Literal: []byte(text)}})
+	return p
+}
+
+// listNode returns a list with items made of the nodes.
+func listNode(flags ast.ListType, start int, items ...[]ast.Node) *ast.List {
+	list := &ast.List{ListFlags: flags, Start: start}
+	for _, children := range items {
+		item := &ast.ListItem{ListFlags: flags}
+		for _, child := range children {
+			ast.AppendChild(item, child)
+		}
+		ast.AppendChild(list, item)
+	}
+	return list
+}
+
+// Lists and links with a text are not produced by the protocol parser
+// but they are rendered if the parser supports them one day.
+func TestRenderMarkdownNodes(t *testing.T) {
+	defer setColors(false)()
+	theme := loadTestTheme(t)
+
+	link := &ast.Link{Destination: []byte("https://status.im/docs")}
+	ast.AppendChild(link, &ast.Text{Leaf: ast.Leaf{Literal: []byte("the docs")}})
+	linkParagraph := &ast.Paragraph{}
+	ast.AppendChild(linkParagraph, link)
+
+	testCases := []struct {
+		name     string
+		node     ast.Node
+		expected []string
+	}{
+		{
+			name:     "list",
+			node:     listNode(0, 0, []ast.Node{textNode("one")}, []ast.Node{textNode("two")}),
+			expected: []string{"• one", "• two"},
+		},
+		{
+			name:     "ordered list",
+			node:     listNode(ast.ListTypeOrdered, 3, []ast.Node{textNode("three")}, []ast.Node{textNode("four")}),
+			expected: []string{"3. three", "4. four"},
+		},
+		{
+			name: "nested lists",
+			node: listNode(0, 0,
+				[]ast.Node{
+					textNode("one"),
+					listNode(0, 0, []ast.Node{
+						textNode("nested"),
+						listNode(ast.ListTypeOrdered, 1, []ast.Node{textNode("deep")}),
+					}),
+				},
+				[]ast.Node{textNode("two")},
+			),
+			expected: []string{"• one", "  • nested", "    1. deep", "• two"},
+		},
+		{
+			name:     "link with a text",
+			node:     linkParagraph,
+			expected: []string{"the docs <https://status.im/docs>"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			r := markdownRenderer{theme: theme}
+			lines := r.renderBlock(tc.node)
+			if !reflect.DeepEqual(lines, tc.expected) {
+				t.Fatalf("expected %q, got %q", tc.expected, lines)
+			}
+		})
+	}
+}
+
+func TestWrapLine(t *testing.T) {
+	bold := sgr([]color.Attribute{color.Bold})
+
+	testCases := []struct {
+		name     string
+		line     string
+		width    int
+		expected []string
+	}{
+		{
+			name:     "shorter than width",
+			line:     "short line",
+			width:    20,
+			expected: []string{"short line"},
+		},
+		{
+			name:     "unknown width",
+			line:     "a line which is not wrapped",
+			width:    0,
+			expected: []string{"a line which is not wrapped"},
+		},
+		{
+			name:     "wrapped at width",
+			line:     "one two three four",
+			width:    9,
+			expected: []string{"one two", "  three", "  four"},
+		},
+		{
+			name:     "escape sequences do not count",
+			line:     bold + "one" + sgrReset + " two three",
+			width:    7,
+			expected: []string{bold + "one" + sgrReset + " two", "  three"},
+		},
+		{
+			name:     "long words are left to the view",
+			line:     "verylongword a b",
+			width:    5,
+			expected: []string{"verylongword", "  a b"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			lines := wrapLine(tc.line, tc.width, "  ")
+			if !reflect.DeepEqual(lines, tc.expected) {
+				t.Fatalf("expected %q, got %q", tc.expected, lines)
+			}
+		})
+	}
+}
+
+func TestRenderAsMarkdown(t *testing.T) {
+	testCases := []struct {
+		contentType protobuf.ChatMessage_ContentType
+		rawText     bool
+		expected    bool
+	}{
+		{contentType: protobuf.ChatMessage_TEXT_PLAIN, rawText: false, expected: true},
+		{contentType: protobuf.ChatMessage_TEXT_PLAIN, rawText: true, expected: false},
+		{contentType: protobuf.ChatMessage_STATUS, rawText: false, expected: true},
+		{contentType: protobuf.ChatMessage_STATUS, rawText: true, expected: false},
+		{contentType: protobuf.ChatMessage_STICKER, rawText: false, expected: false},
+		{contentType: protobuf.ChatMessage_EMOJI, rawText: false, expected: false},
+		{contentType: protobuf.ChatMessage_COMMAND, rawText: false, expected: false},
+	}
+
+	for _, tc := range testCases {
+		if actual := renderAsMarkdown(tc.contentType, tc.rawText); actual != tc.expected {
+			t.Errorf("%s with raw text %t: expected %t, got %t", tc.contentType, tc.rawText, tc.expected, actual)
+		}
+	}
+}
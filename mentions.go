@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/status-im/status-go/protocol"
+	"github.com/status-im/status-go/protocol/identity/alias"
+)
+
+// mentionsChatID is an ID of a virtual chat collecting mentions.
+// It can't collide with public chats which don't allow colons.
+const mentionsChatID = ":mentions"
+
+// newMentionsChat returns the virtual chat collecting mentions.
+func newMentionsChat() *protocol.Chat {
+	return &protocol.Chat{ID: mentionsChatID, Name: "mentions", Active: true}
+}
+
+// isVirtualChat returns true for chats which exist only in the client.
+func isVirtualChat(chat *protocol.Chat) bool {
+	return chat.ID == mentionsChatID
+}
+
+// mentionMatcher detects messages which mention us.
+type mentionMatcher struct {
+	patterns []*regexp.Regexp
+}
+
+// newMentionMatcher returns a matcher of our alias, ENS name and keywords.
+// Keywords are matched as whole words ignoring case
+// unless they are regular expressions written as /expr/.
+func newMentionMatcher(alias, ensName string, keywords []string) (*mentionMatcher, error) {
+	words := []string{alias}
+	if ensName != "" {
+		words = append(words, ensName)
+		// ENS names are usually referred to without the domain.
+		if idx := strings.IndexByte(ensName, '.'); idx > 0 {
+			words = append(words, ensName[:idx])
+		}
+	}
+
+	m := &mentionMatcher{}
+	for _, k := range keywords {
+		k = strings.TrimSpace(k)
+		if len(k) > 2 && strings.HasPrefix(k, "/") && strings.HasSuffix(k, "/") {
+			re, err := regexp.Compile(k[1 : len(k)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid keyword %s: %v", k, err)
+			}
+			m.patterns = append(m.patterns, re)
+		} else if k != "" {
+			words = append(words, k)
+		}
+	}
+	for _, w := range words {
+		m.patterns = append(m.patterns, regexp.MustCompile(`(?i)(^|\W)`+regexp.QuoteMeta(w)+`($|\W)`))
+	}
+	return m, nil
+}
+
+// newMentionMatcherForKey returns a matcher of the alias generated from the public key.
+func newMentionMatcherForKey(publicKey, ensName string, keywords []string) (*mentionMatcher, error) {
+	name, err := alias.GenerateFromPublicKeyString(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return newMentionMatcher(name, ensName, keywords)
+}
+
+// Match returns true if the text mentions us.
+func (m *mentionMatcher) Match(text string) bool {
+	for _, re := range m.patterns {
+		if re.MatchString(text) {
+			return true
+		}
+	}
+	return false
+}
+
+// ringBell rings the terminal bell. It must be called from the main loop
+// so that it's not written in the middle of the terminal output.
+func ringBell() {
+	_, _ = os.Stdout.WriteString("\a")
+}
+
+// chatLabel returns a short name of the chat the message belongs to.
+func chatLabel(chatID string) string {
+	if strings.HasPrefix(chatID, "0x") {
+		if name, err := alias.GenerateFromPublicKeyString(chatID); err == nil {
+			return "@" + name
+		}
+	}
+	return "#" + truncateText(chatID, 20)
+}
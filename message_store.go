@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/status-im/status-go/protocol"
+)
+
+// defaultChatCapacity is a default maximum number
+// of messages kept in memory per chat.
+const defaultChatCapacity = 1000
+
+// messageCursor returns a database cursor pointing at the message.
+// It has the same format as cursors returned by MessageByChatID,
+// i.e. a zero-padded clock followed by the message ID.
+func messageCursor(m *protocol.Message) string {
+	return fmt.Sprintf("%064d", m.Clock) + m.ID
+}
+
+// messageLess orders messages by clock and then by ID,
+// in the same way as the database does.
+func messageLess(a, b *protocol.Message) bool {
+	if a.Clock != b.Clock {
+		return a.Clock < b.Clock
+	}
+	return a.ID < b.ID
+}
+
+// chatMessages are messages of a single chat ordered by clock.
+type chatMessages struct {
+	messages []*protocol.Message
+	ids      map[string]*protocol.Message
+	// cursor is a database cursor of the oldest message
+	// which is not in memory. An empty cursor means
+	// that all messages were loaded.
+	cursor string
+	// loaded is true if the cursor was set by the database.
+	loaded bool
+}
+
+// messageStore keeps recent messages of chats in memory.
+//
+// Each chat keeps at most capacity messages. When it's exceeded,
+// the oldest messages are evicted and the chat cursor is moved
+// so that they are loaded again from the database when needed.
+// The active chat is not trimmed, so that loading older messages
+// does not evict them immediately; it's trimmed once another
+// chat becomes active.
+//
+// It is not safe for concurrent use.
+type messageStore struct {
+	capacity int
+	chats    map[string]*chatMessages
+	active   string
+}
+
+func newMessageStore(capacity int) *messageStore {
+	if capacity <= 0 {
+		capacity = defaultChatCapacity
+	}
+	return &messageStore{
+		capacity: capacity,
+		chats:    make(map[string]*chatMessages),
+	}
+}
+
+func (s *messageStore) chat(chatID string) *chatMessages {
+	chat, ok := s.chats[chatID]
+	if !ok {
+		chat = &chatMessages{ids: make(map[string]*protocol.Message)}
+		s.chats[chatID] = chat
+	}
+	return chat
+}
+
+// Messages returns messages of the chat ordered by clock.
+// The returned slice must not be modified.
+func (s *messageStore) Messages(chatID string) []*protocol.Message {
+	chat, ok := s.chats[chatID]
+	if !ok {
+		return nil
+	}
+	return chat.messages
+}
+
+// ChatIDs returns IDs of chats with messages in the store.
+func (s *messageStore) ChatIDs() []string {
+	ids := make([]string, 0, len(s.chats))
+	for id := range s.chats {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Find returns a message of the chat by its ID.
+func (s *messageStore) Find(chatID, id string) *protocol.Message {
+	chat, ok := s.chats[chatID]
+	if !ok {
+		return nil
+	}
+	return chat.ids[id]
+}
+
+// Add inserts messages into the chat keeping them ordered.
+// Messages which are already in the store are skipped.
+// It returns added messages and whether all of them
+// were appended after the messages already in the store.
+func (s *messageStore) Add(chatID string, messages ...*protocol.Message) ([]*protocol.Message, bool) {
+	chat := s.chat(chatID)
+
+	var added []*protocol.Message
+	appended := true
+	for _, m := range messages {
+		if _, ok := chat.ids[m.ID]; ok {
+			continue
+		}
+		chat.ids[m.ID] = m
+
+		idx := sort.Search(len(chat.messages), func(i int) bool {
+			return messageLess(m, chat.messages[i])
+		})
+		if idx < len(chat.messages) {
+			appended = false
+		}
+		chat.messages = append(chat.messages, nil)
+		copy(chat.messages[idx+1:], chat.messages[idx:])
+		chat.messages[idx] = m
+		added = append(added, m)
+	}
+
+	if chatID != s.active {
+		s.trim(chat)
+	}
+
+	return added, appended
+}
+
+// Remove removes a message from the chat.
+func (s *messageStore) Remove(chatID, id string) {
+	chat, ok := s.chats[chatID]
+	if !ok {
+		return
+	}
+	if _, ok := chat.ids[id]; !ok {
+		return
+	}
+	delete(chat.ids, id)
+	for i, m := range chat.messages {
+		if m.ID == id {
+			chat.messages = append(chat.messages[:i], chat.messages[i+1:]...)
+			break
+		}
+	}
+}
+
+// RemoveIf removes messages of all chats which match the predicate.
+func (s *messageStore) RemoveIf(match func(*protocol.Message) bool) {
+	for _, chat := range s.chats {
+		filtered := chat.messages[:0]
+		for _, m := range chat.messages {
+			if match(m) {
+				delete(chat.ids, m.ID)
+				continue
+			}
+			filtered = append(filtered, m)
+		}
+		// Do not keep references to removed messages.
+		for i := len(filtered); i < len(chat.messages); i++ {
+			chat.messages[i] = nil
+		}
+		chat.messages = filtered
+	}
+}
+
+// RemoveChat drops all messages of the chat.
+func (s *messageStore) RemoveChat(chatID string) {
+	delete(s.chats, chatID)
+}
+
+// Cursor returns a database cursor of the oldest message
+// of the chat which is not in memory. ok is false if
+// nothing was loaded from the database yet.
+func (s *messageStore) Cursor(chatID string) (cursor string, ok bool) {
+	chat, found := s.chats[chatID]
+	if !found || !chat.loaded {
+		return "", false
+	}
+	return chat.cursor, true
+}
+
+// SetCursor sets a database cursor returned by MessageByChatID.
+func (s *messageStore) SetCursor(chatID, cursor string) {
+	chat := s.chat(chatID)
+	chat.cursor = cursor
+	chat.loaded = true
+}
+
+// SetActive marks the chat as active so that it is not trimmed.
+// The previously active chat is trimmed to the capacity.
+func (s *messageStore) SetActive(chatID string) {
+	if s.active == chatID {
+		return
+	}
+	if prev, ok := s.chats[s.active]; ok {
+		s.trim(prev)
+	}
+	s.active = chatID
+}
+
+// trim evicts the oldest messages exceeding the capacity.
+// The cursor points at the newest evicted message
+// so that it's the first one loaded from the database.
+func (s *messageStore) trim(chat *chatMessages) {
+	n := len(chat.messages) - s.capacity
+	if n <= 0 {
+		return
+	}
+
+	chat.cursor = messageCursor(chat.messages[n-1])
+	chat.loaded = true
+
+	for _, m := range chat.messages[:n] {
+		delete(chat.ids, m.ID)
+	}
+	// Copy messages to release the evicted ones.
+	chat.messages = append([]*protocol.Message(nil), chat.messages[n:]...)
+}
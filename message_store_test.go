@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/status-im/status-go/protocol"
+)
+
+func testMessage(id string, clock uint64) *protocol.Message {
+	m := &protocol.Message{ID: id}
+	m.Clock = clock
+	return m
+}
+
+func messageIDs(messages []*protocol.Message) []string {
+	ids := make([]string, 0, len(messages))
+	for _, m := range messages {
+		ids = append(ids, m.ID)
+	}
+	return ids
+}
+
+func TestMessageStoreAdd(t *testing.T) {
+	testCases := []struct {
+		name     string
+		initial  []*protocol.Message
+		add      []*protocol.Message
+		ids      []string
+		added    []string
+		appended bool
+	}{
+		{
+			name:     "empty store",
+			add:      []*protocol.Message{testMessage("b", 2), testMessage("a", 1)},
+			ids:      []string{"a", "b"},
+			added:    []string{"b", "a"},
+			appended: false,
+		},
+		{
+			name:     "newer messages",
+			initial:  []*protocol.Message{testMessage("a", 1)},
+			add:      []*protocol.Message{testMessage("b", 2), testMessage("c", 3)},
+			ids:      []string{"a", "b", "c"},
+			added:    []string{"b", "c"},
+			appended: true,
+		},
+		{
+			name:     "older message",
+			initial:  []*protocol.Message{testMessage("b", 2)},
+			add:      []*protocol.Message{testMessage("a", 1)},
+			ids:      []string{"a", "b"},
+			added:    []string{"a"},
+			appended: false,
+		},
+		{
+			name:     "same clock ordered by ID",
+			initial:  []*protocol.Message{testMessage("a", 1), testMessage("c", 1)},
+			add:      []*protocol.Message{testMessage("b", 1)},
+			ids:      []string{"a", "b", "c"},
+			added:    []string{"b"},
+			appended: false,
+		},
+		{
+			name:     "same clock with greater ID",
+			initial:  []*protocol.Message{testMessage("a", 1)},
+			add:      []*protocol.Message{testMessage("b", 1)},
+			ids:      []string{"a", "b"},
+			added:    []string{"b"},
+			appended: true,
+		},
+		{
+			name:     "duplicate IDs are ignored",
+			initial:  []*protocol.Message{testMessage("a", 1), testMessage("b", 2)},
+			add:      []*protocol.Message{testMessage("a", 1), testMessage("b", 5), testMessage("c", 3)},
+			ids:      []string{"a", "b", "c"},
+			added:    []string{"c"},
+			appended: true,
+		},
+		{
+			name:     "only duplicates",
+			initial:  []*protocol.Message{testMessage("a", 1)},
+			add:      []*protocol.Message{testMessage("a", 1)},
+			ids:      []string{"a"},
+			added:    []string{},
+			appended: true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newMessageStore(10)
+			s.Add("chat", tc.initial...)
+
+			added, appended := s.Add("chat", tc.add...)
+			if ids := messageIDs(added); !reflect.DeepEqual(ids, tc.added) {
+				t.Errorf("expected added %v, got %v", tc.added, ids)
+			}
+			if appended != tc.appended {
+				t.Errorf("expected appended %t, got %t", tc.appended, appended)
+			}
+			if ids := messageIDs(s.Messages("chat")); !reflect.DeepEqual(ids, tc.ids) {
+				t.Errorf("expected messages %v, got %v", tc.ids, ids)
+			}
+		})
+	}
+}
+
+func TestMessageStoreTrim(t *testing.T) {
+	testCases := []struct {
+		name     string
+		capacity int
+		add      []*protocol.Message
+		ids      []string
+		cursor   string
+		loaded   bool
+	}{
+		{
+			name:     "within capacity",
+			capacity: 3,
+			add:      []*protocol.Message{testMessage("a", 1), testMessage("b", 2), testMessage("c", 3)},
+			ids:      []string{"a", "b", "c"},
+			loaded:   false,
+		},
+		{
+			name:     "capacity exceeded",
+			capacity: 2,
+			add:      []*protocol.Message{testMessage("a", 1), testMessage("b", 2), testMessage("c", 3), testMessage("d", 4)},
+			ids:      []string{"c", "d"},
+			cursor:   fmt.Sprintf("%064d", 2) + "b",
+			loaded:   true,
+		},
+		{
+			name:     "capacity exceeded with the same clock",
+			capacity: 1,
+			add:      []*protocol.Message{testMessage("b", 7), testMessage("a", 7)},
+			ids:      []string{"b"},
+			cursor:   fmt.Sprintf("%064d", 7) + "a",
+			loaded:   true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newMessageStore(tc.capacity)
+			s.Add("chat", tc.add...)
+
+			if ids := messageIDs(s.Messages("chat")); !reflect.DeepEqual(ids, tc.ids) {
+				t.Errorf("expected messages %v, got %v", tc.ids, ids)
+			}
+			cursor, ok := s.Cursor("chat")
+			if ok != tc.loaded {
+				t.Fatalf("expected cursor set %t, got %t", tc.loaded, ok)
+			}
+			if cursor != tc.cursor {
+				t.Errorf("expected cursor %q, got %q", tc.cursor, cursor)
+			}
+			if !ok {
+				return
+			}
+			// MessageByChatID returns messages with cursor <= ?,
+			// so the evicted messages must be loaded again
+			// and the kept ones must not.
+			for _, m := range tc.add {
+				evicted := s.Find("chat", m.ID) == nil
+				if loadable := messageCursor(m) <= cursor; loadable != evicted {
+					t.Errorf("message %s: expected loadable %t, got %t", m.ID, evicted, loadable)
+				}
+			}
+		})
+	}
+}
+
+func TestMessageStoreSetActive(t *testing.T) {
+	s := newMessageStore(2)
+	s.SetActive("chat")
+	s.Add("chat", testMessage("a", 1), testMessage("b", 2), testMessage("c", 3))
+
+	if ids := messageIDs(s.Messages("chat")); !reflect.DeepEqual(ids, []string{"a", "b", "c"}) {
+		t.Fatalf("expected the active chat not to be trimmed, got %v", ids)
+	}
+	if _, ok := s.Cursor("chat"); ok {
+		t.Fatalf("expected no cursor for the active chat")
+	}
+
+	s.SetActive("other")
+
+	if ids := messageIDs(s.Messages("chat")); !reflect.DeepEqual(ids, []string{"b", "c"}) {
+		t.Fatalf("expected the previously active chat to be trimmed, got %v", ids)
+	}
+	if s.Find("chat", "a") != nil {
+		t.Fatalf("expected the evicted message not to be found")
+	}
+	cursor, ok := s.Cursor("chat")
+	if !ok || cursor != fmt.Sprintf("%064d", 1)+"a" {
+		t.Fatalf("unexpected cursor %q (%t)", cursor, ok)
+	}
+}
+
+func TestMessageStoreRemoveIf(t *testing.T) {
+	s := newMessageStore(10)
+	s.Add("chat1", testMessage("a", 1), testMessage("b", 2), testMessage("c", 3))
+	s.Add("chat2", testMessage("d", 1), testMessage("e", 2))
+
+	s.RemoveIf(func(m *protocol.Message) bool {
+		return m.ID == "b" || m.ID == "d" || m.ID == "e"
+	})
+
+	testCases := []struct {
+		chatID string
+		ids    []string
+	}{
+		{chatID: "chat1", ids: []string{"a", "c"}},
+		{chatID: "chat2", ids: []string{}},
+	}
+
+	for _, tc := range testCases {
+		if ids := messageIDs(s.Messages(tc.chatID)); !reflect.DeepEqual(ids, tc.ids) {
+			t.Errorf("%s: expected messages %v, got %v", tc.chatID, tc.ids, ids)
+		}
+	}
+	for _, id := range []string{"b", "d", "e"} {
+		if s.Find("chat1", id) != nil || s.Find("chat2", id) != nil {
+			t.Errorf("expected message %s to be removed", id)
+		}
+	}
+	if s.Find("chat1", "a") == nil {
+		t.Errorf("expected message a to be kept")
+	}
+
+	// Removed messages can be added again.
+	if added, _ := s.Add("chat1", testMessage("b", 2)); len(added) != 1 {
+		t.Errorf("expected removed message to be added again")
+	}
+}
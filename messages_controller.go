@@ -6,11 +6,11 @@ import (
 	"encoding/hex"
 	"errors"
 	"fmt"
-	"sort"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 
 	"github.com/fatih/color"
@@ -18,26 +18,89 @@ import (
 
 	"github.com/status-im/status-go/eth-node/crypto"
 	"github.com/status-im/status-go/protocol"
+	"github.com/status-im/status-go/protocol/identity/alias"
 	"github.com/status-im/status-go/protocol/protobuf"
 )
 
+// messagesPageSize is a number of messages
+// loaded from the database at once.
+const messagesPageSize = 10
+
+// localMessageIDPrefix prefixes IDs of messages
+// which failed to be sent and exist only in memory.
+const localMessageIDPrefix = "local-"
+
+// stickerFallbackText is sent as a text of stickers
+// for clients which do not support them.
+const stickerFallbackText = "Update to latest version to see a nice sticker here!"
+
+// Retrieval backoff limits used when retrieving messages fails.
+const (
+	minRetrievalBackoff = time.Second
+	maxRetrievalBackoff = 30 * time.Second
+)
+
+// maxQuoteLength is a maximum number of characters
+// of a quoted message displayed in the chat view.
+const maxQuoteLength = 60
+
 // MessagesViewController manages chat view.
 type MessagesViewController struct {
 	*ViewController
 
-	// TODO: It should be a round buffer instead.
-	// It is a map with chatID as a key and a list of messages.
-	store          map[string][]*protocol.Message
+	// store keeps recent messages of chats and their database cursors.
+	// It is guarded by the mutex.
+	store          *messageStore
 	mutex          sync.Mutex
 	identity       *ecdsa.PrivateKey
 	myPubkeyString string
 	messenger      *protocol.Messenger
 	logger         *zap.Logger
 
+	// activeChat and replyTo are guarded by the mutex
+	// as messages are also sent from other goroutines.
 	activeChat *protocol.Chat
-	onError    func(error)
-	onMessages func()
+	// unreadSince is an ID of the first message
+	// which was not seen when the active chat was selected.
+	unreadSince string
+	replyTo     *protocol.Message
+	inputTitle  string
+	// rawText disables rendering messages as markdown.
+	// It is accessed only from the main loop.
+	rawText bool
+	// lines maps lines of the view buffer to message IDs.
+	// It is accessed only from the main loop.
+	lines []string
+
+	notifications *NotificationViewController
+	onMessages    func()
+	// onChatChanged is called from the main loop
+	// after the active chat changes.
+	onChatChanged func(previous, next *protocol.Chat) error
+	// onRetrieved is called after each attempt to retrieve messages.
+	onRetrieved func(at time.Time, err error)
+	// onPending is called with a number of own messages
+	// which are being sent every time it might change.
+	onPending func(pending int)
+	// trackSend calls send which sends a message and returns its ID
+	// so that its status can be tracked.
+	trackSend func(send func() (messageID string, err error)) error
+
+	// mentions detects messages mentioning us. If nil, mentions are ignored.
+	// It is set before starting the controller.
+	mentions *mentionMatcher
+	bell     bool
+	// mentioned is a set of chats with mentions which were not viewed.
+	// It is guarded by the mutex.
+	mentioned  map[string]bool
+	onMentions func(chatIDs []string)
+
 	changeChat chan *protocol.Chat
+	// retrieve triggers retrieving messages.
+	retrieve chan struct{}
+	// pollInterval is how often messages are retrieved
+	// if nothing triggers retrieving them.
+	pollInterval time.Duration
 
 	cancel chan struct{} // cancel the current chat loop
 	done   chan struct{} // wait for the current chat loop to finish
@@ -48,27 +111,102 @@ func NewMessagesViewController(
 	vc *ViewController,
 	id Identity,
 	m *protocol.Messenger,
+	pollInterval time.Duration,
+	chatCapacity int,
+	notifications *NotificationViewController,
 	logger *zap.Logger,
 	onMessages func(),
-	onError func(error),
 ) *MessagesViewController {
 	if onMessages == nil {
 		onMessages = func() {}
 	}
-	if onError == nil {
-		onError = func(error) {}
-	}
 
 	return &MessagesViewController{
 		ViewController: vc,
+		onRetrieved:    func(time.Time, error) {},
+		onPending:      func(int) {},
+		trackSend: func(send func() (string, error)) error {
+			_, err := send()
+			return err
+		},
 		identity:       id,
 		myPubkeyString: "0x" + hex.EncodeToString(crypto.FromECDSAPub(&id.PublicKey)),
-		store:          make(map[string][]*protocol.Message),
+		store:          newMessageStore(chatCapacity),
 		messenger:      m,
 		logger:         logger.With(zap.Namespace("MessagesViewController")),
 		onMessages:     onMessages,
-		onError:        onError,
+		notifications:  notifications,
+		mentioned:      make(map[string]bool),
 		changeChat:     make(chan *protocol.Chat, 1),
+		retrieve:       make(chan struct{}, 1),
+		pollInterval:   pollInterval,
+	}
+}
+
+// WatchMentions makes the controller collect messages matched by the matcher
+// in the mentions chat and flag chats they were sent to.
+// If bell is true, the terminal bell rings when we are mentioned.
+// It must be called before Start.
+func (c *MessagesViewController) WatchMentions(matcher *mentionMatcher, bell bool, onMentions func(chatIDs []string)) {
+	if onMentions == nil {
+		onMentions = func([]string) {}
+	}
+	c.mentions = matcher
+	c.bell = bell
+	c.onMentions = onMentions
+}
+
+// OnChatChanged sets a callback called from the main loop
+// when the active chat changes. previous is nil if no chat was active.
+// It must be called before Start.
+func (c *MessagesViewController) OnChatChanged(fn func(previous, next *protocol.Chat) error) {
+	c.onChatChanged = fn
+}
+
+// OnRetrieved sets a callback called after each attempt to retrieve messages
+// with its time and an error if it failed.
+// It must be called before Start.
+func (c *MessagesViewController) OnRetrieved(fn func(at time.Time, err error)) {
+	c.onRetrieved = fn
+}
+
+// OnPendingChanged sets a callback called with a number of own messages
+// which are being sent when they are sent or their status changes.
+// It must be called before Start.
+func (c *MessagesViewController) OnPendingChanged(fn func(pending int)) {
+	c.onPending = fn
+}
+
+// TrackSend sets a function which wraps sending every message
+// so that its status can be tracked after it's sent.
+// It must be called before Start.
+func (c *MessagesViewController) TrackSend(fn func(send func() (messageID string, err error)) error) {
+	c.trackSend = fn
+}
+
+// sendTracked sends a message with send using the tracking function.
+func (c *MessagesViewController) sendTracked(send func() (*protocol.MessengerResponse, error)) (*protocol.MessengerResponse, error) {
+	var response *protocol.MessengerResponse
+	err := c.trackSend(func() (string, error) {
+		var err error
+		response, err = send()
+		if err != nil {
+			return "", err
+		}
+		if len(response.Messages) == 0 {
+			return "", nil
+		}
+		return response.Messages[0].ID, nil
+	})
+	return response, err
+}
+
+// TriggerRetrieval makes the controller retrieve messages
+// as soon as possible. Multiple triggers are coalesced.
+func (c *MessagesViewController) TriggerRetrieval() {
+	select {
+	case c.retrieve <- struct{}{}:
+	default:
 	}
 }
 
@@ -79,14 +217,20 @@ func (c *MessagesViewController) Start() error {
 		chats := c.messenger.Chats()
 
 		for _, chat := range chats {
-			// Pull latest 10 messages
-			latestMessages, _, err := c.messenger.MessageByChatID(chat.ID, "", 10)
+			// Pull the latest page of messages
+			latestMessages, cursor, err := c.messenger.MessageByChatID(chat.ID, "", messagesPageSize)
 			if err != nil {
 				return err
 			}
 
 			c.mutex.Lock()
-			c.store[chat.ID] = append(c.store[chat.ID], latestMessages...)
+			c.store.Add(chat.ID, latestMessages...)
+			c.store.SetCursor(chat.ID, cursor)
+			for _, m := range latestMessages {
+				if c.isMention(m) {
+					c.store.Add(mentionsChatID, m)
+				}
+			}
 			c.mutex.Unlock()
 		}
 
@@ -98,93 +242,216 @@ func (c *MessagesViewController) Start() error {
 func (c *MessagesViewController) handleRetrievedMessages(response *protocol.MessengerResponse) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	byChat := make(map[string][]*protocol.Message)
 	for _, m := range response.Messages {
-		c.store[m.LocalChatID] = append(c.store[m.LocalChatID], m)
+		byChat[m.LocalChatID] = append(byChat[m.LocalChatID], m)
+	}
+
+	var (
+		latestForActive []*protocol.Message
+		appended        bool
+		mentions        []*protocol.Message
+	)
+	for chatID, messages := range byChat {
+		added, ok := c.store.Add(chatID, messages...)
+		if c.activeChat != nil && c.activeChat.ID == chatID {
+			latestForActive, appended = added, ok
+		}
+		for _, m := range added {
+			if c.isMention(m) {
+				mentions = append(mentions, m)
+			}
+		}
+	}
+
+	if len(mentions) > 0 {
+		added, ok := c.store.Add(mentionsChatID, mentions...)
+		if c.activeChat != nil && c.activeChat.ID == mentionsChatID {
+			latestForActive, appended = added, ok
+		}
+		c.alertMentions(added)
 	}
 
 	c.onMessages()
 
-	if c.activeChat == nil {
+	if len(latestForActive) == 0 {
 		return
 	}
 
-	var latestForActive []*protocol.Message
-	for _, m := range response.Messages {
-		if m.LocalChatID == c.activeChat.ID {
-			latestForActive = append(latestForActive, m)
-		}
+	// Messages which do not belong to the end
+	// of the chat require repainting all of them.
+	if !appended {
+		c.printMessages(true, c.store.Messages(c.activeChat.ID)...)
+		return
 	}
+	c.printMessages(false, latestForActive...)
+}
 
-	if len(latestForActive) == 0 {
+// isMention returns true if the message was sent by someone else and mentions us.
+func (c *MessagesViewController) isMention(m *protocol.Message) bool {
+	return c.mentions != nil && m.From != c.myPubkeyString && c.mentions.Match(m.Text)
+}
+
+// alertMentions flags chats of the mentions and notifies about them.
+// It must be called with the mutex held.
+func (c *MessagesViewController) alertMentions(mentions []*protocol.Message) {
+	var unseen []*protocol.Message
+	for _, m := range mentions {
+		if m.Seen {
+			continue
+		}
+		unseen = append(unseen, m)
+		if c.activeChat == nil || c.activeChat.ID != m.LocalChatID {
+			c.mentioned[m.LocalChatID] = true
+		}
+	}
+	if len(unseen) == 0 {
 		return
 	}
 
-	var messagesToDraw []*protocol.Message
+	c.onMentions(c.mentionedChatIDs())
 
-	repaint := isRepaintNeeded(latestForActive, c.store[c.activeChat.ID])
-	if repaint {
-		messagesToDraw = c.store[c.activeChat.ID]
+	if c.bell {
+		c.g.Update(func(*gocui.Gui) error {
+			ringBell()
+			return nil
+		})
+	}
+
+	if len(unseen) == 1 {
+		m := unseen[0]
+		c.notifications.Info("Mention", fmt.Sprintf("%s in %s: %s", m.Alias, chatLabel(m.LocalChatID), m.Text))
 	} else {
-		messagesToDraw = latestForActive
+		c.notifications.Info("Mention", fmt.Sprintf("%d new mentions", len(unseen)))
 	}
+}
 
-	sortMessages(messagesToDraw)
-	c.printMessages(repaint, messagesToDraw...)
+// mentionedChatIDs returns IDs of chats with mentions which were not viewed.
+// It must be called with the mutex held.
+func (c *MessagesViewController) mentionedChatIDs() []string {
+	ids := make([]string, 0, len(c.mentioned))
+	for id := range c.mentioned {
+		ids = append(ids, id)
+	}
+	return ids
 }
 
 func (c *MessagesViewController) readMessagesLoop() {
 	c.done = make(chan struct{})
 	defer close(c.done)
 
-	t := time.NewTicker(time.Second)
+	// Messages are retrieved when triggered by new envelopes
+	// and periodically in case a trigger was missed.
+	// If retrieving fails, it's retried with a backoff.
+	t := time.NewTimer(c.pollInterval)
 	defer t.Stop()
 
+	var backoff time.Duration
+
+	retrieve := func() {
+		response, err := c.messenger.RetrieveAll()
+		c.onRetrieved(time.Now(), err)
+		if err != nil {
+			backoff = nextRetrievalBackoff(backoff)
+			c.logger.Error("failed to retrieve messages", zap.Error(err), zap.Duration("backoff", backoff))
+			resetTimer(t, backoff)
+			return
+		}
+		backoff = 0
+		resetTimer(t, c.pollInterval)
+
+		if len(response.Messages) == 0 {
+			return
+		}
+		c.logger.Info("received latest messages", zap.Int("count", len(response.Messages)))
+		c.handleRetrievedMessages(response)
+	}
+
 	for {
 		select {
 		case <-t.C:
-			response, err := c.messenger.RetrieveAll()
-			if err != nil {
-				c.logger.Error("failed to retrieve messages", zap.Error(err))
+			retrieve()
+
+		case <-c.retrieve:
+			// Wait for the backoff to pass.
+			if backoff > 0 {
 				continue
 			}
-
-			c.logger.Info("received latest messages", zap.Int("count", len(response.Messages)))
-			c.handleRetrievedMessages(response)
+			retrieve()
 
 		case chat := <-c.changeChat:
+			c.mutex.Lock()
+			previous := c.activeChat
 			c.activeChat = chat
-			c.logger.Info("changed active chat", zap.Int("count", len(c.store[chat.ID])))
-			c.printMessages(true, c.store[chat.ID]...)
+			c.store.SetActive(chat.ID)
+			c.unreadSince = ""
+			messages := c.store.Messages(chat.ID)
+			for _, m := range messages {
+				if !m.Seen && m.From != c.myPubkeyString {
+					c.unreadSince = m.ID
+					break
+				}
+			}
+			if c.mentioned[chat.ID] {
+				delete(c.mentioned, chat.ID)
+				c.onMentions(c.mentionedChatIDs())
+			}
+			c.logger.Info("changed active chat", zap.Int("count", len(messages)))
+			c.printMessages(true, messages...)
+			c.mutex.Unlock()
+			c.g.Update(func(*gocui.Gui) error {
+				c.CancelReply()
+				if c.onChatChanged != nil {
+					return c.onChatChanged(previous, chat)
+				}
+				return nil
+			})
 		case <-c.cancel:
 			return
 		}
 	}
 }
 
-func sortMessages(messages []*protocol.Message) {
-	sort.SliceStable(messages, func(i, j int) bool {
-		return messages[i].Clock < messages[j].Clock
-	})
+// nextRetrievalBackoff doubles the backoff within the limits.
+func nextRetrievalBackoff(backoff time.Duration) time.Duration {
+	backoff *= 2
+	if backoff < minRetrievalBackoff {
+		return minRetrievalBackoff
+	}
+	if backoff > maxRetrievalBackoff {
+		return maxRetrievalBackoff
+	}
+	return backoff
 }
 
-func isRepaintNeeded(latest, messages []*protocol.Message) bool {
-	lastClock := uint64(0)
-	if len(messages) > 0 {
-		lastClock = messages[len(messages)-1].Clock
-	}
-	for _, l := range latest {
-		if l.Clock < lastClock {
-			return true
+// resetTimer resets the timer which might have already fired.
+func resetTimer(t *time.Timer, d time.Duration) {
+	if !t.Stop() {
+		select {
+		case <-t.C:
+		default:
 		}
 	}
-	return false
+	t.Reset(d)
 }
 
 // ActiveChat returns the active chat, if any
 func (c *MessagesViewController) ActiveChat() *protocol.Chat {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	return c.activeChat
 }
 
+// Messages returns messages of the active chat kept in memory.
+func (c *MessagesViewController) Messages() []*protocol.Message {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.activeChat == nil {
+		return nil
+	}
+	return append([]*protocol.Message(nil), c.store.Messages(c.activeChat.ID)...)
+}
+
 // Select informs the chat view controller about a selected contact.
 // The chat view controller setup subscribers and request recent messages.
 func (c *MessagesViewController) Select(chat *protocol.Chat) {
@@ -192,81 +459,836 @@ func (c *MessagesViewController) Select(chat *protocol.Chat) {
 	c.changeChat <- chat
 }
 
-// Send sends a payload as a message.
-func (c *MessagesViewController) Send(ctx context.Context, text string) (*protocol.MessengerResponse, error) {
+// LoadMore loads the previous page of messages of the active chat
+// from the database and prepends them keeping the scroll position.
+func (c *MessagesViewController) LoadMore() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Virtual chats are not stored in the database.
+	if c.activeChat == nil || isVirtualChat(c.activeChat) {
+		return nil
+	}
+
+	chatID := c.activeChat.ID
+	cursor, ok := c.store.Cursor(chatID)
+	if ok && cursor == "" {
+		// reached the beginning of the chat
+		return nil
+	}
+
+	messages, cursor, err := c.messenger.MessageByChatID(chatID, cursor, messagesPageSize)
+	if err != nil {
+		return err
+	}
+	c.store.SetCursor(chatID, cursor)
+
+	older, _ := c.store.Add(chatID, messages...)
+
+	c.logger.Info("loaded older messages", zap.String("chatID", chatID), zap.Int("count", len(older)))
+
+	if len(older) == 0 {
+		return nil
+	}
+
+	messagesToDraw := c.store.Messages(chatID)
+	unreadSince := c.unreadSince
+	c.resolveQuotes(messagesToDraw)
+	c.g.Update(func(*gocui.Gui) error {
+		if active := c.ActiveChat(); active == nil || active.ID != chatID {
+			return nil
+		}
+
+		v, err := c.view()
+		if err != nil {
+			return err
+		}
+
+		prevLinesCount := len(c.lines)
+		_, oy := v.Origin()
+
+		if err := c.Clear(); err != nil {
+			return err
+		}
+		c.lines = nil
+		if err := c.writeMessages(messagesToDraw, unreadSince, false); err != nil {
+			return err
+		}
+
+		// Keep the previously visible lines where they were.
+		added := len(c.lines) - prevLinesCount
+		if added <= 0 {
+			return nil
+		}
+		return v.SetOrigin(0, oy+viewLinesCount(v, v.BufferLines()[:added]))
+	})
+
+	return nil
+}
+
+// UpdateOutgoingStatus changes a status of sent messages
+// and repaints the view if any of them belongs to the active chat.
+func (c *MessagesViewController) UpdateOutgoingStatus(ids []string, status string) {
+	c.mutex.Lock()
+
+	var (
+		updated []string
+		repaint bool
+	)
+	for _, id := range ids {
+		confirmed := false
+		for _, chatID := range c.store.ChatIDs() {
+			m := c.store.Find(chatID, id)
+			if m == nil {
+				continue
+			}
+			// A confirmation might be reported before
+			// the message is reported sent.
+			if m.OutgoingStatus == OutgoingStatusConfirmed && status == protocol.OutgoingStatusSent {
+				confirmed = true
+				continue
+			}
+			m.OutgoingStatus = status
+			if c.activeChat != nil && c.activeChat.ID == chatID {
+				repaint = true
+			}
+		}
+		if !confirmed {
+			updated = append(updated, id)
+		}
+	}
+
+	if repaint {
+		c.redraw()
+	}
+	c.notifyPending()
+	c.mutex.Unlock()
+
+	for _, id := range updated {
+		if err := c.messenger.UpdateMessageOutgoingStatus(id, status); err != nil {
+			c.logger.Error("failed to update outgoing status", zap.String("id", id), zap.Error(err))
+		}
+	}
+}
+
+// notifyPending passes a number of own messages which are being sent
+// to the callback. It must be called with the mutex held.
+func (c *MessagesViewController) notifyPending() {
+	pending := 0
+	for _, chatID := range c.store.ChatIDs() {
+		if chatID == mentionsChatID {
+			continue
+		}
+		for _, m := range c.store.Messages(chatID) {
+			if m.From == c.myPubkeyString && m.OutgoingStatus == protocol.OutgoingStatusSending {
+				pending++
+			}
+		}
+	}
+	c.onPending(pending)
+}
+
+// redraw repaints all messages of the active chat
+// keeping the current scroll and cursor position.
+// It must be called with the mutex held.
+func (c *MessagesViewController) redraw() {
+	chatID := c.activeChat.ID
+	withChat := isVirtualChat(c.activeChat)
+	messages := c.store.Messages(chatID)
+	unreadSince := c.unreadSince
+	c.resolveQuotes(messages)
+	c.g.Update(func(*gocui.Gui) error {
+		if active := c.ActiveChat(); active == nil || active.ID != chatID {
+			return nil
+		}
+
+		v, err := c.view()
+		if err != nil {
+			return err
+		}
+
+		ox, oy := v.Origin()
+		cx, cy := v.Cursor()
+
+		v.Clear()
+		c.lines = nil
+		if err := c.writeMessages(messages, unreadSince, withChat); err != nil {
+			return err
+		}
+
+		if err := v.SetOrigin(ox, oy); err != nil {
+			return err
+		}
+		return v.SetCursor(cx, cy)
+	})
+}
+
+// MessageAtCursor returns a message displayed
+// at the current cursor position of the view.
+func (c *MessagesViewController) MessageAtCursor(v *gocui.View) (*protocol.Message, bool) {
+	idx := bufferLineIdx(v)
+	if idx < 0 || idx >= len(c.lines) {
+		return nil, false
+	}
+	return c.messageByID(c.lines[idx])
+}
+
+func (c *MessagesViewController) messageByID(id string) (*protocol.Message, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
 	if c.activeChat == nil {
-		return nil, errors.New("no selected chat")
+		return nil, false
+	}
+	if m := c.store.Find(c.activeChat.ID, id); m != nil {
+		return m, true
+	}
+	return nil, false
+}
+
+// ReplyTo marks the next sent message as a response to the given message.
+// It must be called from the main loop.
+func (c *MessagesViewController) ReplyTo(message *protocol.Message) {
+	c.mutex.Lock()
+	c.replyTo = message
+	c.mutex.Unlock()
+	c.updateInputTitle(message)
+}
+
+// ReplyingTo returns the message the next sent message responds to, if any.
+// It must be called from the main loop.
+func (c *MessagesViewController) ReplyingTo() *protocol.Message {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.replyTo
+}
+
+// CancelReply leaves the reply mode.
+// It must be called from the main loop.
+func (c *MessagesViewController) CancelReply() {
+	c.mutex.Lock()
+	c.replyTo = nil
+	c.mutex.Unlock()
+	c.updateInputTitle(nil)
+}
+
+// updateInputTitle shows the message replied to in the input view title.
+func (c *MessagesViewController) updateInputTitle(replyTo *protocol.Message) {
+	view := c.vm.ViewByName(ViewInput)
+	if view == nil {
+		return
+	}
+	if c.inputTitle == "" {
+		c.inputTitle = view.Title
+	}
+	if replyTo == nil {
+		view.Title = c.inputTitle
+		return
+	}
+	view.Title = fmt.Sprintf(
+		"%s (replying to %s: %s)",
+		ViewInput,
+		replyTo.Alias,
+		truncateText(formatContent(replyTo), maxQuoteLength),
+	)
+}
+
+// RemoveChat drops messages of a removed chat from the store.
+// If the chat is the active one, the view is cleared.
+func (c *MessagesViewController) RemoveChat(chatID string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.store.RemoveChat(chatID)
+
+	if c.activeChat != nil && c.activeChat.ID == chatID {
+		c.activeChat = nil
+		c.printMessages(true)
+	}
+}
+
+// RemoveMessagesFrom drops all messages sent by the given public key
+// from the store and repaints the active chat.
+func (c *MessagesViewController) RemoveMessagesFrom(publicKey string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.store.RemoveIf(func(m *protocol.Message) bool {
+		return m.From == publicKey
+	})
+
+	if c.activeChat != nil {
+		c.redraw()
 	}
-	c.logger.Info("sending message", zap.String("chatID", c.activeChat.ID), zap.String("text", text))
+}
+
+// Send sends a payload as a message.
+// If sending fails, the message is kept in the view
+// with a failed status so that it can be resent.
+func (c *MessagesViewController) Send(ctx context.Context, text string) (*protocol.MessengerResponse, error) {
 	message := &protocol.Message{}
-	message.ChatId = c.activeChat.ID
 	message.Text = text
 	message.ContentType = protobuf.ChatMessage_TEXT_PLAIN
-	response, err := c.messenger.SendChatMessage(ctx, message)
+	return c.send(ctx, message)
+}
+
+// SendSticker sends a sticker from the given pack.
+func (c *MessagesViewController) SendSticker(ctx context.Context, pack int32, hash string) (*protocol.MessengerResponse, error) {
+	message := &protocol.Message{}
+	// Clients which do not support stickers display the text.
+	message.Text = stickerFallbackText
+	message.ContentType = protobuf.ChatMessage_STICKER
+	message.Payload = &protobuf.ChatMessage_Sticker{
+		Sticker: &protobuf.StickerMessage{Hash: hash, Pack: pack},
+	}
+	return c.send(ctx, message)
+}
+
+// SendEmoji sends an emoji which is displayed emphasised.
+func (c *MessagesViewController) SendEmoji(ctx context.Context, emoji string) (*protocol.MessengerResponse, error) {
+	message := &protocol.Message{}
+	message.Text = emoji
+	message.ContentType = protobuf.ChatMessage_EMOJI
+	return c.send(ctx, message)
+}
+
+func (c *MessagesViewController) send(ctx context.Context, message *protocol.Message) (*protocol.MessengerResponse, error) {
+	c.mutex.Lock()
+	chat, replyTo := c.activeChat, c.replyTo
+	c.mutex.Unlock()
+
+	if chat == nil {
+		err := errors.New("no selected chat")
+		c.notifications.Error("Chat error", err.Error())
+		return nil, err
+	}
+	if isVirtualChat(chat) {
+		err := fmt.Errorf("can't send messages to the %s chat", chat.Name)
+		c.notifications.Error("Chat error", err.Error())
+		return nil, err
+	}
+	c.logger.Info(
+		"sending message",
+		zap.String("chatID", chat.ID),
+		zap.String("contentType", message.ContentType.String()),
+		zap.String("text", message.Text),
+	)
+	message.ChatId = chat.ID
+
+	if replyTo != nil && replyTo.LocalChatID == chat.ID {
+		message.ResponseTo = replyTo.ID
+	}
+
+	if replyTo != nil {
+		c.g.Update(func(*gocui.Gui) error {
+			c.CancelReply()
+			return nil
+		})
+	}
+
+	response, err := c.sendTracked(func() (*protocol.MessengerResponse, error) {
+		return c.messenger.SendChatMessage(ctx, message)
+	})
 	if err != nil {
+		c.addFailedMessage(message, replyTo)
+		c.notifications.Error("Chat error", err.Error())
 		return nil, err
 	}
 	m := response.Messages[0]
 
-	c.mutex.Lock()
-	c.store[m.LocalChatID] = append(c.store[m.LocalChatID], m)
+	if replyTo != nil {
+		m.QuotedMessage = &protocol.QuotedMessage{From: replyTo.From, Text: replyTo.Text}
+	}
 
-	c.printMessages(false, m)
+	c.mutex.Lock()
+	// The message might have been already retrieved.
+	if added, appended := c.store.Add(m.LocalChatID, m); !appended {
+		c.printMessages(true, c.store.Messages(m.LocalChatID)...)
+	} else if len(added) > 0 {
+		c.printMessages(false, m)
+	}
+	c.notifyPending()
 	c.mutex.Unlock()
 
 	return response, nil
 }
 
+// addFailedMessage adds a message which could not be sent
+// to the store. As it was not saved in the database,
+// it gets a local ID.
+func (c *MessagesViewController) addFailedMessage(message *protocol.Message, replyTo *protocol.Message) {
+	message.ID = localMessageIDPrefix + uuid.New().String()
+	message.LocalChatID = message.ChatId
+	message.From = c.myPubkeyString
+	message.OutgoingStatus = OutgoingStatusFailed
+	if message.Alias == "" {
+		message.Alias, _ = alias.GenerateFromPublicKeyString(c.myPubkeyString)
+	}
+	if message.WhisperTimestamp == 0 {
+		message.WhisperTimestamp = uint64(time.Now().Unix())
+	}
+	if replyTo != nil {
+		message.QuotedMessage = &protocol.QuotedMessage{From: replyTo.From, Text: replyTo.Text}
+	}
+
+	c.mutex.Lock()
+	_, appended := c.store.Add(message.LocalChatID, message)
+	if c.activeChat != nil && c.activeChat.ID == message.LocalChatID {
+		if appended {
+			c.printMessages(false, message)
+		} else {
+			c.printMessages(true, c.store.Messages(message.LocalChatID)...)
+		}
+	}
+	c.mutex.Unlock()
+}
+
+// LastFailedMessage returns the most recent own message of the active chat
+// which expired or could not be sent.
+func (c *MessagesViewController) LastFailedMessage() (*protocol.Message, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.activeChat == nil {
+		return nil, false
+	}
+	messages := c.store.Messages(c.activeChat.ID)
+	for i := len(messages) - 1; i >= 0; i-- {
+		m := messages[i]
+		if m.From != c.myPubkeyString {
+			continue
+		}
+		if m.OutgoingStatus == OutgoingStatusExpired || m.OutgoingStatus == OutgoingStatusFailed {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// FindMessage looks up a message of the active chat by its ID or a unique ID prefix.
+func (c *MessagesViewController) FindMessage(id string) (*protocol.Message, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.activeChat == nil {
+		return nil, errors.New("no selected chat")
+	}
+
+	if m := c.store.Find(c.activeChat.ID, id); m != nil {
+		return m, nil
+	}
+
+	var found *protocol.Message
+	for _, m := range c.store.Messages(c.activeChat.ID) {
+		if strings.HasPrefix(m.ID, id) {
+			if found != nil {
+				return nil, fmt.Errorf("message ID %s is ambiguous", id)
+			}
+			found = m
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("message %s not found", id)
+	}
+	return found, nil
+}
+
+// Resend sends again an own message which expired or could not be sent.
+// Failures are reported using the error callback.
+func (c *MessagesViewController) Resend(ctx context.Context, message *protocol.Message) error {
+	err := c.resend(ctx, message)
+	if err != nil {
+		c.notifications.Error("Chat error", fmt.Sprintf("failed to resend message: %v", err))
+	}
+	return err
+}
+
+func (c *MessagesViewController) resend(ctx context.Context, message *protocol.Message) error {
+	if message.From != c.myPubkeyString {
+		return errors.New("only own messages can be resent")
+	}
+
+	c.logger.Info("resending message", zap.String("id", message.ID))
+
+	var (
+		response *protocol.MessengerResponse
+		err      error
+	)
+	if strings.HasPrefix(message.ID, localMessageIDPrefix) {
+		// The message was never saved so it needs to be sent from scratch.
+		retry := &protocol.Message{}
+		retry.ChatId = message.LocalChatID
+		retry.Text = message.Text
+		retry.ContentType = message.ContentType
+		retry.Payload = message.Payload
+		retry.ResponseTo = message.ResponseTo
+		response, err = c.sendTracked(func() (*protocol.MessengerResponse, error) {
+			return c.messenger.SendChatMessage(ctx, retry)
+		})
+	} else {
+		response, err = c.sendTracked(func() (*protocol.MessengerResponse, error) {
+			return c.messenger.ReSendChatMessage(ctx, message.ID)
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(response.Messages) > 0 {
+		// The message is indexed by its ID and ordered by clock
+		// so it needs to be added again after they change.
+		c.store.Remove(message.LocalChatID, message.ID)
+		message.ID = response.Messages[0].ID
+		message.Clock = response.Messages[0].Clock
+		c.store.Add(message.LocalChatID, message)
+	}
+	message.RetryCount++
+	message.OutgoingStatus = protocol.OutgoingStatusSending
+	c.notifyPending()
+
+	if c.activeChat != nil && c.activeChat.ID == message.LocalChatID {
+		c.redraw()
+	}
+
+	return nil
+}
+
+// resolveQuotes finds messages the given messages respond to.
+// It must be called with the mutex held.
+func (c *MessagesViewController) resolveQuotes(messages []*protocol.Message) {
+	for _, m := range messages {
+		if m.ResponseTo == "" || m.QuotedMessage != nil {
+			continue
+		}
+
+		quoted := c.store.Find(m.LocalChatID, m.ResponseTo)
+		if quoted == nil {
+			var err error
+			quoted, err = c.messenger.MessageByID(m.ResponseTo)
+			if err != nil || quoted == nil {
+				c.logger.Debug("failed to find a quoted message", zap.String("id", m.ResponseTo), zap.Error(err))
+				continue
+			}
+		}
+		m.QuotedMessage = &protocol.QuotedMessage{From: quoted.From, Text: quoted.Text}
+	}
+}
+
+// printMessages draws messages in the view.
+// It must be called with the mutex held.
 func (c *MessagesViewController) printMessages(clear bool, messages ...*protocol.Message) {
 	c.logger.Debug("printing messages", zap.Int("count", len(messages)))
+	unreadSince := c.unreadSince
+	withChat := c.activeChat != nil && isVirtualChat(c.activeChat)
+	c.resolveQuotes(messages)
 	c.g.Update(func(*gocui.Gui) error {
 		if clear {
 			if err := c.Clear(); err != nil {
 				return err
 			}
+			c.lines = nil
 		}
 
-		for _, message := range messages {
-			if err := c.writeMessage(message); err != nil {
+		if err := c.writeMessages(messages, unreadSince, withChat); err != nil {
+			return err
+		}
+
+		v, err := c.view()
+		if err != nil {
+			return err
+		}
+		c.MarkSeenIfAtBottom(v)
+		return nil
+	})
+}
+
+// writeMessages writes messages to the view and draws a separator
+// before the message with unreadSince ID.
+// If withChat is true, messages are prefixed with their chats.
+func (c *MessagesViewController) writeMessages(messages []*protocol.Message, unreadSince string, withChat bool) error {
+	for _, message := range messages {
+		if message.ID == unreadSince {
+			if _, err := fmt.Fprintln(c.ViewController, styled("-------- unread since here --------", c.vm.Theme().System)); err != nil {
 				return err
 			}
+			c.lines = append(c.lines, "")
 		}
+		if err := c.writeMessage(message, withChat); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarkSeenIfAtBottom marks messages of the active chat as seen
+// if the view is scrolled to the bottom.
+// It must be called from the main loop.
+func (c *MessagesViewController) MarkSeenIfAtBottom(v *gocui.View) {
+	if !isScrolledToBottom(v) {
+		return
+	}
+	go func() {
+		if err := c.markSeen(); err != nil {
+			c.logger.Error("failed to mark messages seen", zap.Error(err))
+		}
+	}()
+}
+
+func (c *MessagesViewController) markSeen() error {
+	c.mutex.Lock()
+	if c.activeChat == nil {
+		c.mutex.Unlock()
 		return nil
-	})
+	}
+	// Messages of virtual chats belong to other chats.
+	byChat := make(map[string][]string)
+	for _, m := range c.store.Messages(c.activeChat.ID) {
+		if !m.Seen {
+			byChat[m.LocalChatID] = append(byChat[m.LocalChatID], m.ID)
+			m.Seen = true
+		}
+	}
+	c.mutex.Unlock()
+
+	if len(byChat) == 0 {
+		return nil
+	}
+
+	for chatID, ids := range byChat {
+		c.logger.Debug("marking messages seen", zap.String("chatID", chatID), zap.Int("count", len(ids)))
+
+		if err := c.messenger.MarkMessagesSeen(chatID, ids); err != nil {
+			return err
+		}
+	}
+
+	c.onMessages()
+
+	return nil
 }
 
-func (c *MessagesViewController) writeMessage(message *protocol.Message) error {
+func isScrolledToBottom(v *gocui.View) bool {
+	lines := v.BufferLines()
+	// the last line is empty because of the trailing new line
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	_, oy := v.Origin()
+	_, sy := v.Size()
+	return viewLinesCount(v, lines) <= oy+sy
+}
 
-	line := formatMessageLine(
-		message.Alias,
-		message.From,
-		message.ID,
-		int64(message.Clock),
-		message.WhisperTimestamp,
-		message.Text,
-	)
+func (c *MessagesViewController) writeMessage(message *protocol.Message, withChat bool) error {
+	theme := c.vm.Theme()
+
+	if message.QuotedMessage != nil {
+		if _, err := fmt.Fprintln(c.ViewController, styled(formatQuoteLine(message.QuotedMessage), theme.Quote)); err != nil {
+			return err
+		}
+		c.lines = append(c.lines, message.ID)
+	} else if message.ResponseTo != "" {
+		if _, err := fmt.Fprintln(c.ViewController, styled("  > in reply to "+message.ResponseTo, theme.Quote)); err != nil {
+			return err
+		}
+		c.lines = append(c.lines, message.ID)
+	}
 
-	println := fmt.Fprintln
-	// TODO: extract
+	style := contentStyle(message.ContentType, theme)
+	// Own messages are distinguished by their colour
+	// and others by colours of their authors.
+	authorStyle := theme.AuthorStyle(message.From)
 	if message.From == c.myPubkeyString {
-		println = color.New(color.FgGreen).Fprintln
+		style = theme.OwnMessage
+		authorStyle = nil
+	} else if c.isMention(message) {
+		style = theme.Mention
+	}
+	header := func(text string) string {
+		line := formatMessageLine(
+			span(message.Alias, authorStyle, style),
+			message.From,
+			message.ID,
+			int64(message.Clock),
+			span(formatTimestamp(message.WhisperTimestamp), theme.Timestamp, style),
+			text,
+		)
+		if withChat {
+			line = chatLabel(message.LocalChatID) + " | " + line
+		}
+		return line
 	}
 
-	if _, err := println(c.ViewController, line); err != nil {
-		return err
+	if !renderAsMarkdown(message.ContentType, c.rawText) {
+		line := header(formatContent(message)) + c.formatOutgoingStatus(message)
+
+		if _, err := fmt.Fprintln(c.ViewController, styled(line, style)); err != nil {
+			return err
+		}
+		for i := strings.Count(line, "\n"); i >= 0; i-- {
+			c.lines = append(c.lines, message.ID)
+		}
+		return nil
+	}
+
+	content := renderMarkdown(message.Text, style, theme)
+	if message.ContentType == protobuf.ChatMessage_STATUS {
+		content[0] = "[status] " + content[0]
+	}
+	content[len(content)-1] += c.formatOutgoingStatus(message)
+
+	width := 0
+	if v, err := c.view(); err == nil {
+		maxX, _ := v.Size()
+		width = maxX - 1
+	}
+
+	for i, text := range content {
+		line := continuationIndent + text
+		if i == 0 {
+			line = header(text)
+		}
+		for _, wrapped := range wrapLine(line, width, continuationIndent) {
+			if _, err := fmt.Fprintln(c.ViewController, styled(wrapped, style)); err != nil {
+				return err
+			}
+			c.lines = append(c.lines, message.ID)
+		}
 	}
 
 	return nil
 }
 
-func formatMessageLine(alias string, from string, messageID string, clock int64, t uint64, text string) string {
+// formatOutgoingStatus returns a suffix with a status of own messages.
+func (c *MessagesViewController) formatOutgoingStatus(message *protocol.Message) string {
+	if message.From != c.myPubkeyString {
+		return ""
+	}
+	if message.RetryCount > 0 {
+		return fmt.Sprintf(" [%s, retries: %d]", message.OutgoingStatus, message.RetryCount)
+	} else if message.OutgoingStatus != "" {
+		return fmt.Sprintf(" [%s]", message.OutgoingStatus)
+	}
+	return ""
+}
+
+// ToggleMarkdown switches between rendering messages
+// as markdown and displaying their raw text.
+// It must be called from the main loop.
+func (c *MessagesViewController) ToggleMarkdown() {
+	c.rawText = !c.rawText
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.activeChat != nil {
+		c.redraw()
+	}
+}
+
+func formatMessageLine(alias string, from string, messageID string, clock int64, timestamp string, text string) string {
 	return fmt.Sprintf(
-		"%s | %s | %#+x | %d | %s | %s",
+		"%s | %s | %s | %d | %s | %s",
 		alias,
 		from[:9],
-		messageID[2:3],
+		shortMessageID(messageID),
 		clock,
-		time.Unix(int64(t), 0).Format(time.RFC822),
+		timestamp,
 		strings.TrimSpace(text),
 	)
 }
+
+func formatTimestamp(t uint64) string {
+	return time.Unix(int64(t), 0).Format(time.RFC822)
+}
+
+// formatContent returns a text representation of the message
+// depending on its content type.
+func formatContent(message *protocol.Message) string {
+	text := strings.TrimSpace(message.Text)
+
+	switch message.ContentType {
+	case protobuf.ChatMessage_STICKER:
+		sticker := message.GetSticker()
+		if sticker == nil {
+			return "[sticker]"
+		}
+		return fmt.Sprintf("[sticker %s from pack %d]", shortStickerHash(sticker.Hash), sticker.Pack)
+	case protobuf.ChatMessage_EMOJI:
+		return fmt.Sprintf("%s  %s  %s", text, text, text)
+	case protobuf.ChatMessage_STATUS:
+		return fmt.Sprintf("[status] %s", text)
+	case protobuf.ChatMessage_COMMAND:
+		if text == "" {
+			return "[command]"
+		}
+		return fmt.Sprintf("[command] %s", text)
+	case protobuf.ChatMessage_COMMAND_REQUEST:
+		if text == "" {
+			return "[transaction request]"
+		}
+		return fmt.Sprintf("[transaction request] %s", text)
+	default:
+		return text
+	}
+}
+
+// contentStyle returns attributes of the message
+// depending on its content type.
+func contentStyle(contentType protobuf.ChatMessage_ContentType, theme *Theme) []color.Attribute {
+	switch contentType {
+	case protobuf.ChatMessage_STICKER:
+		return theme.Sticker
+	case protobuf.ChatMessage_EMOJI:
+		return theme.Emoji
+	case protobuf.ChatMessage_STATUS:
+		return theme.System
+	case protobuf.ChatMessage_COMMAND, protobuf.ChatMessage_COMMAND_REQUEST:
+		return theme.Command
+	default:
+		return theme.Message
+	}
+}
+
+// shortStickerHash shortens a content hash of a sticker.
+func shortStickerHash(hash string) string {
+	if len(hash) > 16 {
+		return hash[:16] + "…"
+	}
+	return hash
+}
+
+// shortMessageID returns a prefix of the message ID
+// which is long enough to reference the message in commands.
+func shortMessageID(id string) string {
+	if strings.HasPrefix(id, localMessageIDPrefix) {
+		return id[:len(localMessageIDPrefix)+8]
+	}
+	if len(id) > 10 {
+		return id[:10]
+	}
+	return id
+}
+
+func formatQuoteLine(quote *protocol.QuotedMessage) string {
+	name, err := alias.GenerateFromPublicKeyString(quote.From)
+	if err != nil {
+		name = quote.From
+	}
+	return fmt.Sprintf("  > %s: %s", name, truncateText(quote.Text, maxQuoteLength))
+}
+
+// truncateText returns the first line of the text
+// shortened to at most n characters.
+func truncateText(text string, n int) string {
+	text = strings.TrimSpace(text)
+	if idx := strings.IndexByte(text, '\n'); idx != -1 {
+		text = text[:idx] + "…"
+	}
+	runes := []rune(text)
+	if len(runes) > n {
+		return string(runes[:n]) + "…"
+	}
+	return text
+}
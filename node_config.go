@@ -4,6 +4,9 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/ethereum/go-ethereum/p2p/enode"
+
+	"github.com/status-im/status-go/eth-node/types"
 	"github.com/status-im/status-go/params"
 )
 
@@ -41,3 +44,20 @@ func generateStatusNodeConfig(dataDir, fleet, listenAddr string, configFile stri
 
 	return config, nil
 }
+
+// isMailserverFunc returns a function which tells
+// whether a peer is one of the given mail servers.
+func isMailserverFunc(enodes []string) func(types.EnodeID) bool {
+	ids := make(map[types.EnodeID]struct{}, len(enodes))
+	for _, e := range enodes {
+		node, err := enode.ParseV4(e)
+		if err != nil {
+			continue
+		}
+		ids[types.EnodeID(node.ID())] = struct{}{}
+	}
+	return func(id types.EnodeID) bool {
+		_, ok := ids[id]
+		return ok
+	}
+}
@@ -15,90 +15,211 @@ type signalEnvelope struct {
 	Event json.RawMessage `json:"event"`
 }
 
-type mailTypeEvent struct {
-	RequestID        types.Hash `json:"requestID"`
-	Hash             types.Hash `json:"hash"`
-	LastEnvelopeHash types.Hash `json:"lastEnvelopeHash"`
+// mailTypeSignal is an event of a mail server request.
+type mailTypeSignal struct {
+	Type      types.EventType
+	RequestID string
+	// Peer is an ID of the mail server the request was sent to.
+	Peer string
+	// Cursor is set by completed requests with more pages.
+	Cursor []byte
+	// Error is set by completed requests which failed.
+	Error error
 }
 
-type mailTypeSignal struct {
-	Type           string
-	RequestID      string
-	LastEnvelopeID []byte
+// peerInfo is a part of p2p.PeerInfo sent in the discovery summary.
+type peerInfo struct {
+	ID string `json:"id"`
 }
 
+// signalForwarder forwards node signals to the user interface.
+//
+// Mail server request events are routed to subscribers
+// by request IDs, see Filter and FilterSent.
 type signalForwarder struct {
 	sync.Mutex
 
-	in  chan mailTypeSignal
-	out map[string]chan<- mailTypeSignal
+	in   chan mailTypeSignal
+	out  map[string]chan<- mailTypeSignal
+	sent map[string]chan<- mailTypeSignal
+
+	// peers receives IDs of connected peers each time they change.
+	peers chan []string
+	// newMessages receives a value when new messages arrive.
+	newMessages chan struct{}
 }
 
 func newSignalForwarder() *signalForwarder {
 	return &signalForwarder{
-		in:  make(chan mailTypeSignal),
-		out: make(map[string]chan<- mailTypeSignal),
+		in:          make(chan mailTypeSignal, 10),
+		out:         make(map[string]chan<- mailTypeSignal),
+		sent:        make(map[string]chan<- mailTypeSignal),
+		peers:       make(chan []string, 10),
+		newMessages: make(chan struct{}, 1),
 	}
 }
 
-func (s *signalForwarder) Start() {
-	for {
-		sig, ok := <-s.in
-		if !ok {
-			return
-		}
+// NewMessages returns a channel notified when new messages arrive.
+func (s *signalForwarder) NewMessages() <-chan struct{} {
+	return s.newMessages
+}
 
+// Peers returns a channel with IDs of connected peers.
+func (s *signalForwarder) Peers() <-chan []string {
+	return s.peers
+}
+
+// Start routes mail server request events until the input is closed.
+func (s *signalForwarder) Start() {
+	for sig := range s.in {
 		s.Lock()
 		out, found := s.out[sig.RequestID]
-		s.Unlock()
+		if sig.Type == types.EventMailServerRequestSent {
+			out, found = s.sent[sig.Peer]
+		}
 		if found {
-			out <- sig
+			// Subscribers are buffered and expect a few signals
+			// so they are never blocked by a slow reader.
+			select {
+			case out <- sig:
+			default:
+				log.Printf("dropped mail server request signal %s of %s", sig.Type, sig.RequestID)
+			}
 		}
+		s.Unlock()
 	}
 }
 
-func (s *signalForwarder) cancel(reqID []byte) {
+// Filter returns a channel with completed and expired signals
+// of the mail server request and a function cancelling the filter.
+func (s *signalForwarder) Filter(reqID string) (<-chan mailTypeSignal, func()) {
+	c := make(chan mailTypeSignal, 2)
 	s.Lock()
-	delete(s.out, hex.EncodeToString(reqID))
+	s.out[reqID] = c
 	s.Unlock()
+	return c, func() {
+		s.Lock()
+		delete(s.out, reqID)
+		s.Unlock()
+	}
 }
 
-func (s *signalForwarder) Filter(reqID []byte) (<-chan mailTypeSignal, func()) {
-	c := make(chan mailTypeSignal)
+// FilterSent returns a channel with signals of requests sent
+// to the mail server and a function cancelling the filter.
+// A request ID taken from the signal can be used with Filter.
+func (s *signalForwarder) FilterSent(peer string) (<-chan mailTypeSignal, func()) {
+	c := make(chan mailTypeSignal, 2)
 	s.Lock()
-	s.out[hex.EncodeToString(reqID)] = c
+	s.sent[peer] = c
 	s.Unlock()
-	return c, func() { s.cancel(reqID); close(c) }
+	return c, func() {
+		s.Lock()
+		delete(s.sent, peer)
+		s.Unlock()
+	}
+}
+
+func filterPeersHandler(out chan<- []string) func(string) {
+	return func(event string) {
+		var envelope signalEnvelope
+		if err := json.Unmarshal([]byte(event), &envelope); err != nil {
+			log.Printf("failed to unmarshal signal Envelope: %v", err)
+		}
+
+		if envelope.Type != signal.EventDiscoverySummary {
+			return
+		}
+
+		var peers []peerInfo
+		if err := json.Unmarshal(envelope.Event, &peers); err != nil {
+			log.Printf("failed to unmarshal signal event: %v", err)
+		}
+		ids := make([]string, len(peers))
+		for i, p := range peers {
+			ids[i] = p.ID
+		}
+
+		// Do not block the node if nobody reads the peers.
+		select {
+		case out <- ids:
+		default:
+			log.Printf("dropped discovery summary with %d peers", len(ids))
+		}
+	}
 }
 
-func filterMailTypesHandler(in chan<- mailTypeSignal) func(string) {
+func filterNewMessagesHandler(out chan<- struct{}) func(string) {
 	return func(event string) {
 		var envelope signalEnvelope
 		if err := json.Unmarshal([]byte(event), &envelope); err != nil {
 			log.Printf("failed to unmarshal signal Envelope: %v", err)
 		}
 
-		switch envelope.Type {
-		case signal.EventMailServerRequestCompleted:
-			var event mailTypeEvent
-			if err := json.Unmarshal(envelope.Event, &event); err != nil {
-				log.Printf("failed to unmarshal signal event: %v", err)
+		if envelope.Type != signal.EventNewMessages {
+			return
+		}
+
+		// Notifications are coalesced if not read yet.
+		select {
+		case out <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// forwardAvailableEnvelopes notifies the channel when envelopes
+// matching installed filters are received by the node.
+func forwardAvailableEnvelopes(w types.Whisper, out chan<- struct{}) types.Subscription {
+	events := make(chan types.EnvelopeEvent, 100)
+	sub := w.SubscribeEnvelopeEvents(events)
+	go func() {
+		for event := range events {
+			if event.Event != types.EventEnvelopeAvailable {
+				continue
 			}
-			in <- mailTypeSignal{
-				envelope.Type,
-				hex.EncodeToString(event.RequestID.Bytes()),
-				event.LastEnvelopeHash.Bytes(),
+			// Notifications are coalesced if not read yet.
+			select {
+			case out <- struct{}{}:
+			default:
 			}
-		case signal.EventMailServerRequestExpired:
-			var event mailTypeEvent
-			if err := json.Unmarshal(envelope.Event, &event); err != nil {
-				log.Printf("failed to unmarshal signal event: %v", err)
+		}
+	}()
+	return sub
+}
+
+// forwardMailServerRequests forwards events of mail server requests
+// sent by the node, so that they can be tracked by request IDs.
+func forwardMailServerRequests(w types.Whisper, out chan<- mailTypeSignal) types.Subscription {
+	events := make(chan types.EnvelopeEvent, 100)
+	sub := w.SubscribeEnvelopeEvents(events)
+	go func() {
+		for event := range events {
+			sig := mailTypeSignal{
+				Type:      event.Event,
+				RequestID: hex.EncodeToString(event.Hash.Bytes()),
+				Peer:      hex.EncodeToString(event.Peer[:]),
 			}
-			in <- mailTypeSignal{
-				envelope.Type,
-				hex.EncodeToString(event.Hash.Bytes()),
-				nil,
+			switch event.Event {
+			case types.EventMailServerRequestSent, types.EventMailServerRequestExpired:
+			case types.EventMailServerRequestCompleted:
+				if resp, ok := event.Data.(*types.MailServerResponse); ok {
+					sig.Cursor = resp.Cursor
+					sig.Error = resp.Error
+				}
+			default:
+				continue
 			}
+			out <- sig
+		}
+	}()
+	return sub
+}
+
+// multiSignalHandler passes each signal to all handlers.
+func multiSignalHandler(handlers ...func(string)) func(string) {
+	return func(event string) {
+		for _, h := range handlers {
+			h(event)
 		}
 	}
 }
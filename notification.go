@@ -7,54 +7,238 @@ import (
 
 	"github.com/fatih/color"
 	"github.com/jroimartin/gocui"
+	"go.uber.org/zap"
 )
 
+// Severity is a level of a notification.
+type Severity int
+
+// Severity levels.
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return "info"
+	}
+}
+
+const (
+	// maxNotificationHistory is a number of notifications kept in the history.
+	maxNotificationHistory = 500
+	// maxToasts is a number of notifications displayed at once.
+	maxToasts = 3
+	// maxToastLength is a maximum number of characters of a toast.
+	maxToastLength = 100
+	// toastDuration is how long a notification is displayed.
+	toastDuration = 5 * time.Second
+	// errorToastDuration is how long an error is displayed.
+	errorToastDuration = 10 * time.Second
+)
+
+type notification struct {
+	Severity Severity
+	Title    string
+	Message  string
+	Time     time.Time
+}
+
+func (n *notification) String() string {
+	return fmt.Sprintf(
+		"%s | %s | %s | %s",
+		n.Time.Format(time.RFC822),
+		n.Severity,
+		n.Title,
+		n.Message,
+	)
+}
+
+// NotificationViewController shows notifications as toasts
+// which expire on their own and keeps their history
+// which can be browsed in the notifications view.
+//
+// Notifications can be sent from any goroutine.
+// The history and toasts are accessed only from the main loop.
 type NotificationViewController struct {
 	*ViewController
+	toastView string
+	logger    *zap.Logger
+
+	history []*notification
+	toasts  []*notification
 }
 
-func NewNotificationViewController(vc *ViewController) *NotificationViewController {
+// NewNotificationViewController returns a new notifications view controller.
+// vc manages the history view and toastView is a name of the toasts view.
+func NewNotificationViewController(vc *ViewController, toastView string, logger *zap.Logger) *NotificationViewController {
 	return &NotificationViewController{
 		ViewController: vc,
+		toastView:      toastView,
+		logger:         logger.With(zap.Namespace("NotificationViewController")),
 	}
 }
 
-func (n *NotificationViewController) Debug(title, message string) error {
-	if err := n.vm.EnableView(n.viewName); err != nil {
-		return err
+// Info notifies about a regular event.
+func (n *NotificationViewController) Info(title, message string) {
+	n.Notify(SeverityInfo, title, message)
+}
+
+// Warning notifies about an event which might require an action.
+func (n *NotificationViewController) Warning(title, message string) {
+	n.Notify(SeverityWarning, title, message)
+}
+
+// Error notifies about a failure.
+func (n *NotificationViewController) Error(title, message string) {
+	n.Notify(SeverityError, title, message)
+}
+
+// Notify adds a notification to the history and displays it as a toast.
+// It does not block and does not steal focus from the current view.
+func (n *NotificationViewController) Notify(severity Severity, title, message string) {
+	item := &notification{
+		Severity: severity,
+		Title:    title,
+		Message:  strings.TrimSpace(message),
+		Time:     time.Now(),
 	}
 
-	str := fmt.Sprintf(
-		"%s | %s | %s",
-		title,
-		time.Now().Format(time.RFC822),
-		strings.TrimSpace(message),
+	n.logger.Info(
+		"notification",
+		zap.Stringer("severity", severity),
+		zap.String("title", title),
+		zap.String("message", item.Message),
 	)
 
 	n.g.Update(func(*gocui.Gui) error {
-		_, err := color.New(color.FgYellow).Fprintln(n.ViewController, str)
-		return err
+		return n.add(item)
 	})
+}
 
+func (n *NotificationViewController) add(item *notification) error {
+	n.history = append(n.history, item)
+	if len(n.history) > maxNotificationHistory {
+		n.history = append([]*notification(nil), n.history[len(n.history)-maxNotificationHistory:]...)
+	}
+
+	// The history view exists only if it's enabled.
+	if v, err := n.view(); err == nil {
+		if _, err := fmt.Fprintln(v, n.format(item)); err != nil {
+			return err
+		}
+	}
+
+	n.toasts = append(n.toasts, item)
+	if len(n.toasts) > maxToasts {
+		n.toasts = n.toasts[1:]
+	}
+
+	duration := toastDuration
+	if item.Severity == SeverityError {
+		duration = errorToastDuration
+	}
+	time.AfterFunc(duration, func() {
+		n.g.Update(func(*gocui.Gui) error {
+			return n.expire(item)
+		})
+	})
+
+	return n.refreshToasts()
+}
+
+func (n *NotificationViewController) expire(item *notification) error {
+	for i, t := range n.toasts {
+		if t == item {
+			n.toasts = append(n.toasts[:i], n.toasts[i+1:]...)
+			return n.refreshToasts()
+		}
+	}
 	return nil
 }
 
-func (n *NotificationViewController) Error(title, message string) error {
-	if err := n.vm.EnableView(n.viewName); err != nil {
+func (n *NotificationViewController) refreshToasts() error {
+	if len(n.toasts) == 0 {
+		return n.vm.HideView(n.toastView)
+	}
+	if err := n.vm.ShowView(n.toastView); err != nil {
 		return err
 	}
 
-	str := fmt.Sprintf(
-		"%s | %s | %s",
-		title,
-		time.Now().Format(time.RFC822),
-		strings.TrimSpace(message),
-	)
+	v, err := n.vm.RawView(n.toastView)
+	if err != nil {
+		return err
+	}
+	v.Clear()
+	for _, t := range n.toasts {
+		text := truncateText(t.Title+": "+t.Message, maxToastLength)
+		if _, err := fmt.Fprintln(v, styled(text, n.style(t.Severity))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	n.g.Update(func(*gocui.Gui) error {
-		_, err := color.New(color.FgRed).Fprintln(n.ViewController, str)
+// ToastsCount returns a number of displayed toasts.
+// It must be called from the main loop.
+func (n *NotificationViewController) ToastsCount() int {
+	return len(n.toasts)
+}
+
+// Toggle shows or hides the notifications history
+// scrolled to the most recent notifications.
+// It must be called from the main loop.
+func (n *NotificationViewController) Toggle() error {
+	if err := n.vm.ToggleView(n.viewName); err != nil {
 		return err
-	})
+	}
 
-	return nil
+	v, err := n.view()
+	if err != nil {
+		// the view was disabled
+		return nil
+	}
+
+	v.Clear()
+	for _, item := range n.history {
+		if _, err := fmt.Fprintln(v, n.format(item)); err != nil {
+			return err
+		}
+	}
+
+	_, sy := v.Size()
+	lines := len(n.history)
+	if lines == 0 {
+		return nil
+	}
+	if lines <= sy {
+		return v.SetCursor(0, lines-1)
+	}
+	if err := v.SetOrigin(0, lines-sy); err != nil {
+		return err
+	}
+	return v.SetCursor(0, sy-1)
+}
+
+func (n *NotificationViewController) format(item *notification) string {
+	return styled(item.String(), n.style(item.Severity))
+}
+
+func (n *NotificationViewController) style(severity Severity) []color.Attribute {
+	theme := n.vm.Theme()
+	switch severity {
+	case SeverityError:
+		return theme.Error
+	case SeverityWarning:
+		return theme.Warning
+	default:
+		return nil
+	}
 }
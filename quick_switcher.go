@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jroimartin/gocui"
+	"go.uber.org/zap"
+
+	"github.com/status-im/status-go/protocol"
+)
+
+// maxSwitcherRows is a maximum number of chats
+// displayed in the quick switcher at once.
+const maxSwitcherRows = 10
+
+// QuickSwitcher selects a chat found with a fuzzy search
+// over names of chats and aliases and ENS names of contacts.
+// Found chats are ordered by recent activity.
+//
+// The query is typed in its view and found chats
+// are displayed in the results view below it.
+// It is accessed only from the main loop.
+type QuickSwitcher struct {
+	*ViewController
+	resultsView string
+	chats       *ChatsViewController
+	contacts    *ContactsViewController
+	messages    *MessagesViewController
+	logger      *zap.Logger
+
+	matches  []*protocol.Chat
+	selected int
+}
+
+// NewQuickSwitcher returns a new quick switcher.
+// vc manages the query view and resultsView is a name of the results view.
+func NewQuickSwitcher(
+	vc *ViewController,
+	resultsView string,
+	chats *ChatsViewController,
+	contacts *ContactsViewController,
+	messages *MessagesViewController,
+	logger *zap.Logger,
+) *QuickSwitcher {
+	return &QuickSwitcher{
+		ViewController: vc,
+		resultsView:    resultsView,
+		chats:          chats,
+		contacts:       contacts,
+		messages:       messages,
+		logger:         logger.With(zap.Namespace("QuickSwitcher")),
+	}
+}
+
+// Toggle opens the switcher with an empty query or closes it.
+func (s *QuickSwitcher) Toggle() error {
+	if s.vm.ViewByName(s.viewName).Enabled {
+		return s.Close()
+	}
+
+	if err := s.vm.EnableView(s.viewName); err != nil {
+		return err
+	}
+	if err := s.Clear(); err != nil {
+		return err
+	}
+	if err := s.vm.ShowView(s.resultsView); err != nil {
+		return err
+	}
+	return s.Filter("")
+}
+
+// Close hides the switcher and selects the previous view.
+func (s *QuickSwitcher) Close() error {
+	if !s.vm.ViewByName(s.viewName).Enabled {
+		return nil
+	}
+	s.matches = nil
+	if err := s.vm.HideView(s.resultsView); err != nil {
+		return err
+	}
+	return s.vm.ToggleView(s.viewName)
+}
+
+// Filter finds chats matching the query and selects the most recent one.
+func (s *QuickSwitcher) Filter(query string) error {
+	contacts := make(map[string]*protocol.Contact)
+	for _, contact := range s.contacts.Contacts() {
+		contacts[contact.ID] = contact
+	}
+
+	s.matches = nil
+	for _, chat := range s.chats.Chats() {
+		for _, key := range chatSearchKeys(chat, contacts[chat.ID]) {
+			if fuzzyMatch(query, key) {
+				s.matches = append(s.matches, chat)
+				break
+			}
+		}
+	}
+	sort.SliceStable(s.matches, func(i, j int) bool {
+		return s.matches[i].Timestamp > s.matches[j].Timestamp
+	})
+	s.selected = 0
+
+	s.logger.Debug("filtered chats", zap.String("query", query), zap.Int("matches", len(s.matches)))
+
+	return s.render()
+}
+
+// Move moves the selection by delta chats wrapping around the results.
+func (s *QuickSwitcher) Move(delta int) error {
+	if len(s.matches) == 0 {
+		return nil
+	}
+	s.selected = (s.selected + delta + len(s.matches)) % len(s.matches)
+	return s.render()
+}
+
+// Select closes the switcher and makes the selected chat active.
+func (s *QuickSwitcher) Select() error {
+	if len(s.matches) == 0 {
+		return nil
+	}
+	chat := s.matches[s.selected]
+	if err := s.Close(); err != nil {
+		return err
+	}
+	// We need to call Select asynchronously,
+	// otherwise the main thread is blocked.
+	go s.messages.Select(chat)
+	return nil
+}
+
+// ResultsHeight returns a number of lines of the results view.
+func (s *QuickSwitcher) ResultsHeight() int {
+	switch n := len(s.matches); {
+	case n == 0:
+		return 1
+	case n > maxSwitcherRows:
+		return maxSwitcherRows
+	default:
+		return n
+	}
+}
+
+func (s *QuickSwitcher) render() error {
+	v, err := s.vm.RawView(s.resultsView)
+	if err != nil {
+		return err
+	}
+
+	v.Clear()
+	if len(s.matches) == 0 {
+		_, err := fmt.Fprintln(v, styled("no chats found", s.vm.Theme().System))
+		return err
+	}
+	for _, chat := range s.matches {
+		if _, err := fmt.Fprintln(v, chatToString(chat)); err != nil {
+			return err
+		}
+	}
+
+	// Keep the selected chat visible.
+	oy := 0
+	if s.selected >= maxSwitcherRows {
+		oy = s.selected - maxSwitcherRows + 1
+	}
+	if err := v.SetOrigin(0, oy); err != nil {
+		return err
+	}
+	return v.SetCursor(0, s.selected-oy)
+}
+
+// chatSearchKeys returns texts a chat can be found by.
+// contact is nil unless it's a one-to-one chat with a known contact.
+func chatSearchKeys(chat *protocol.Chat, contact *protocol.Contact) []string {
+	keys := []string{chat.Name, chatToString(chat)}
+	if contact != nil {
+		keys = append(keys, contact.Alias, contact.Name)
+	}
+	return keys
+}
+
+// fuzzyMatch returns true if all characters of the query
+// appear in the text in the same order ignoring case and spaces.
+func fuzzyMatch(query, text string) bool {
+	text = strings.ToLower(text)
+	for _, r := range strings.ToLower(query) {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		i := strings.IndexRune(text, r)
+		if i == -1 {
+			return false
+		}
+		text = text[i+utf8.RuneLen(r):]
+	}
+	return true
+}
+
+// switcherEditor edits the query of the quick switcher
+// and filters chats after each change.
+type switcherEditor struct {
+	switcher *QuickSwitcher
+}
+
+// Edit implements gocui.Editor.
+func (e *switcherEditor) Edit(v *gocui.View, key gocui.Key, ch rune, mod gocui.Modifier) {
+	switch {
+	case ch != 0 && mod == 0:
+		v.EditWrite(ch)
+	case key == gocui.KeySpace:
+		v.EditWrite(' ')
+	case key == gocui.KeyBackspace || key == gocui.KeyBackspace2:
+		v.EditDelete(true)
+	case key == gocui.KeyDelete:
+		v.EditDelete(false)
+	case key == gocui.KeyArrowLeft:
+		v.MoveCursor(-1, 0, false)
+		return
+	case key == gocui.KeyArrowRight:
+		v.MoveCursor(1, 0, false)
+		return
+	default:
+		return
+	}
+
+	if err := e.switcher.Filter(inputText(v)); err != nil {
+		e.switcher.logger.Error("failed to filter chats", zap.Error(err))
+	}
+}
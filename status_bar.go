@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jroimartin/gocui"
+	"go.uber.org/zap"
+)
+
+// StatusBarViewController shows a state of the node and messages
+// in a single line: our identity, the fleet, connected peers,
+// the selected mail server, the last retrieval of messages,
+// pending outgoing messages and unread messages.
+//
+// The state can be updated from any goroutine.
+type StatusBarViewController struct {
+	*ViewController
+	mailservers *MailserversViewController
+	logger      *zap.Logger
+
+	// identity, fleet and datasync do not change.
+	identity string
+	fleet    string
+	datasync bool
+
+	sync.Mutex
+	peers        []string
+	retrievedAt  time.Time
+	retrievalErr error
+	pending      int
+	unread       int
+	requests     int
+}
+
+// NewStatusBarViewController returns a new status bar view controller.
+// identity is displayed as is, e.g. an alias with an ENS name.
+func NewStatusBarViewController(
+	vc *ViewController,
+	mailservers *MailserversViewController,
+	identity string,
+	fleet string,
+	datasync bool,
+	logger *zap.Logger,
+) *StatusBarViewController {
+	return &StatusBarViewController{
+		ViewController: vc,
+		mailservers:    mailservers,
+		identity:       identity,
+		fleet:          fleet,
+		datasync:       datasync,
+		logger:         logger.With(zap.Namespace("StatusBarViewController")),
+	}
+}
+
+// SetPeers updates IDs of connected peers.
+func (c *StatusBarViewController) SetPeers(ids []string) {
+	c.Lock()
+	c.peers = ids
+	c.Unlock()
+	c.update()
+}
+
+// SetRetrieved updates the time when messages were last retrieved
+// and an error if retrieving them failed.
+func (c *StatusBarViewController) SetRetrieved(at time.Time, err error) {
+	c.Lock()
+	c.retrievedAt = at
+	c.retrievalErr = err
+	c.Unlock()
+	c.update()
+}
+
+// SetPending updates a number of outgoing messages which are being sent.
+func (c *StatusBarViewController) SetPending(pending int) {
+	c.Lock()
+	c.pending = pending
+	c.Unlock()
+	c.update()
+}
+
+// SetUnread updates a number of unread messages in all chats.
+func (c *StatusBarViewController) SetUnread(unread int) {
+	c.Lock()
+	c.unread = unread
+	c.Unlock()
+	c.update()
+}
+
+// SetRequests updates a number of history requests in flight.
+func (c *StatusBarViewController) SetRequests(requests int) {
+	c.Lock()
+	c.requests = requests
+	c.Unlock()
+	c.update()
+}
+
+func (c *StatusBarViewController) update() {
+	c.g.Update(func(*gocui.Gui) error {
+		return c.Refresh()
+	})
+}
+
+// Refresh repaints the status bar.
+// It must be called from the main loop.
+func (c *StatusBarViewController) Refresh() error {
+	v, err := c.view()
+	if err != nil {
+		return err
+	}
+	v.Clear()
+	_, err = fmt.Fprint(v, c.format())
+	return err
+}
+
+func (c *StatusBarViewController) format() string {
+	theme := c.vm.Theme()
+
+	c.Lock()
+	defer c.Unlock()
+
+	fleet := c.fleet
+	if c.datasync {
+		fleet += " (datasync)"
+	}
+
+	peers := fmt.Sprintf("peers: %d", len(c.peers))
+	if len(c.peers) == 0 {
+		peers = styled(peers, theme.Error)
+	}
+
+	mailserver := "mailserver: none"
+	if m, ok := c.mailservers.Selected(); ok {
+		mailserver = "mailserver: " + m.ID[:16]
+		if !containsString(c.peers, m.ID) {
+			mailserver = styled(mailserver+" (offline)", theme.Warning)
+		}
+	}
+	if c.requests > 0 {
+		mailserver += styled(fmt.Sprintf(" [requests: %d]", c.requests), theme.Highlight)
+	}
+
+	retrieved := "retrieved: never"
+	if !c.retrievedAt.IsZero() {
+		retrieved = "retrieved: " + c.retrievedAt.Format("15:04:05")
+	}
+	if c.retrievalErr != nil {
+		retrieved = styled("retrieval failed: "+c.retrievedAt.Format("15:04:05"), theme.Error)
+	}
+
+	pending := fmt.Sprintf("pending: %d", c.pending)
+	if c.pending > 0 {
+		pending = styled(pending, theme.Warning)
+	}
+
+	unread := fmt.Sprintf("unread: %d", c.unread)
+	if c.unread > 0 {
+		unread = styled(unread, theme.Unread)
+	}
+
+	return strings.Join([]string{c.identity, fleet, peers, mailserver, retrieved, pending, unread}, " | ")
+}
@@ -0,0 +1,460 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/jroimartin/gocui"
+
+	"github.com/status-im/status-go/protocol"
+)
+
+// themeFile is a file in the data dir with a custom theme.
+const themeFile = "theme.json"
+
+// Built-in themes.
+const (
+	ThemeDark       = "dark"
+	ThemeLight      = "light"
+	ThemeMonochrome = "mono"
+)
+
+// themeConfig is a format of theme files.
+//
+// Styles are space-separated lists of a foreground colour,
+// a background colour prefixed with "bg:" and attributes:
+// bold, underline or reverse. Colours are either names
+// (black, red, green, yellow, blue, magenta, cyan, white)
+// or numbers of the 256-colour palette, e.g. "bold 208 bg:black".
+type themeConfig struct {
+	// Base is a built-in theme which is extended.
+	Base        string   `json:"base,omitempty"`
+	View        *string  `json:"view,omitempty"`
+	Frame       *string  `json:"frame,omitempty"`
+	ActiveFrame *string  `json:"active-frame,omitempty"`
+	Selection   *string  `json:"selection,omitempty"`
+	OwnMessage  *string  `json:"own-message,omitempty"`
+	Message     *string  `json:"message,omitempty"`
+	System      *string  `json:"system,omitempty"`
+	Quote       *string  `json:"quote,omitempty"`
+	Timestamp   *string  `json:"timestamp,omitempty"`
+	Error       *string  `json:"error,omitempty"`
+	Warning     *string  `json:"warning,omitempty"`
+	Unread      *string  `json:"unread,omitempty"`
+	Disabled    *string  `json:"disabled,omitempty"`
+	Highlight   *string  `json:"highlight,omitempty"`
+	Mention     *string  `json:"mention,omitempty"`
+	Code        *string  `json:"code,omitempty"`
+	Link        *string  `json:"link,omitempty"`
+	Sticker     *string  `json:"sticker,omitempty"`
+	Emoji       *string  `json:"emoji,omitempty"`
+	Command     *string  `json:"command,omitempty"`
+	Authors     []string `json:"authors,omitempty"`
+	// ChatColors enables using colours of chats in the chats view.
+	ChatColors *bool `json:"chat-colors,omitempty"`
+}
+
+func stringPtr(s string) *string { return &s }
+
+func boolPtr(b bool) *bool { return &b }
+
+var builtinThemes = map[string]themeConfig{
+	ThemeDark: {
+		View:        stringPtr(""),
+		Frame:       stringPtr(""),
+		ActiveFrame: stringPtr("green"),
+		Selection:   stringPtr("black bg:green"),
+		OwnMessage:  stringPtr("green"),
+		Message:     stringPtr(""),
+		System:      stringPtr("red"),
+		Quote:       stringPtr("cyan"),
+		Timestamp:   stringPtr("245"),
+		Error:       stringPtr("red"),
+		Warning:     stringPtr("yellow"),
+		Unread:      stringPtr("bold yellow"),
+		Disabled:    stringPtr("red"),
+		Highlight:   stringPtr("green"),
+		Mention:     stringPtr("bold 203"),
+		Code:        stringPtr("cyan"),
+		Link:        stringPtr("blue underline"),
+		Sticker:     stringPtr("magenta"),
+		Emoji:       stringPtr("bold yellow"),
+		Command:     stringPtr("blue"),
+		Authors:     []string{"cyan", "magenta", "yellow", "blue", "208", "141", "39", "170", "114", "220", "75", "211"},
+		ChatColors:  boolPtr(true),
+	},
+	ThemeLight: {
+		View:        stringPtr(""),
+		Frame:       stringPtr(""),
+		ActiveFrame: stringPtr("blue"),
+		Selection:   stringPtr("white bg:blue"),
+		OwnMessage:  stringPtr("22"),
+		Message:     stringPtr(""),
+		System:      stringPtr("124"),
+		Quote:       stringPtr("30"),
+		Timestamp:   stringPtr("242"),
+		Error:       stringPtr("124"),
+		Warning:     stringPtr("130"),
+		Unread:      stringPtr("bold blue"),
+		Disabled:    stringPtr("124"),
+		Highlight:   stringPtr("22"),
+		Mention:     stringPtr("bold 161"),
+		Code:        stringPtr("30"),
+		Link:        stringPtr("18 underline"),
+		Sticker:     stringPtr("90"),
+		Emoji:       stringPtr("bold 130"),
+		Command:     stringPtr("18"),
+		Authors:     []string{"18", "90", "130", "54", "24", "94", "126", "58", "25", "88"},
+		ChatColors:  boolPtr(true),
+	},
+	ThemeMonochrome: {
+		View:        stringPtr(""),
+		Frame:       stringPtr(""),
+		ActiveFrame: stringPtr("bold"),
+		Selection:   stringPtr("reverse"),
+		OwnMessage:  stringPtr("bold"),
+		Message:     stringPtr(""),
+		System:      stringPtr("underline"),
+		Quote:       stringPtr(""),
+		Timestamp:   stringPtr(""),
+		Error:       stringPtr("bold"),
+		Warning:     stringPtr(""),
+		Unread:      stringPtr("bold"),
+		Disabled:    stringPtr("underline"),
+		Highlight:   stringPtr("bold"),
+		Mention:     stringPtr("bold underline"),
+		Code:        stringPtr(""),
+		Link:        stringPtr("underline"),
+		Sticker:     stringPtr(""),
+		Emoji:       stringPtr("bold"),
+		Command:     stringPtr(""),
+		Authors:     []string{},
+		ChatColors:  boolPtr(false),
+	},
+}
+
+// Theme describes colours of the user interface.
+//
+// Text styles are lists of SGR attributes written
+// to views as escape sequences. View colours are
+// gocui attributes applied to whole views.
+type Theme struct {
+	Name string
+
+	ViewFg, ViewBg           gocui.Attribute
+	FrameFg, FrameBg         gocui.Attribute
+	ActiveFrameFg            gocui.Attribute
+	SelectionFg, SelectionBg gocui.Attribute
+
+	OwnMessage []color.Attribute
+	Message    []color.Attribute
+	System     []color.Attribute
+	Quote      []color.Attribute
+	Timestamp  []color.Attribute
+	Error      []color.Attribute
+	Warning    []color.Attribute
+	Unread     []color.Attribute
+	Disabled   []color.Attribute
+	Highlight  []color.Attribute
+	Mention    []color.Attribute
+	Code       []color.Attribute
+	Link       []color.Attribute
+	Sticker    []color.Attribute
+	Emoji      []color.Attribute
+	Command    []color.Attribute
+	Authors    [][]color.Attribute
+	ChatColors bool
+}
+
+// LoadTheme returns a built-in theme by name
+// or loads a theme file extending a built-in theme.
+func LoadTheme(nameOrPath string) (*Theme, error) {
+	if config, ok := builtinThemes[nameOrPath]; ok {
+		return newTheme(nameOrPath, config)
+	}
+
+	data, err := ioutil.ReadFile(nameOrPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("unknown theme %s", nameOrPath)
+		}
+		return nil, err
+	}
+	var custom themeConfig
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("invalid theme file %s: %v", nameOrPath, err)
+	}
+
+	if custom.Base == "" {
+		custom.Base = ThemeDark
+	}
+	config, ok := builtinThemes[custom.Base]
+	if !ok {
+		return nil, fmt.Errorf("invalid theme file %s: unknown base theme %s", nameOrPath, custom.Base)
+	}
+	config.merge(custom)
+
+	theme, err := newTheme(nameOrPath, config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid theme file %s: %v", nameOrPath, err)
+	}
+	return theme, nil
+}
+
+// merge overrides styles which are set in the other config.
+func (c *themeConfig) merge(other themeConfig) {
+	fields := []struct{ dst, src **string }{
+		{&c.View, &other.View},
+		{&c.Frame, &other.Frame},
+		{&c.ActiveFrame, &other.ActiveFrame},
+		{&c.Selection, &other.Selection},
+		{&c.OwnMessage, &other.OwnMessage},
+		{&c.Message, &other.Message},
+		{&c.System, &other.System},
+		{&c.Quote, &other.Quote},
+		{&c.Timestamp, &other.Timestamp},
+		{&c.Error, &other.Error},
+		{&c.Warning, &other.Warning},
+		{&c.Unread, &other.Unread},
+		{&c.Disabled, &other.Disabled},
+		{&c.Highlight, &other.Highlight},
+		{&c.Mention, &other.Mention},
+		{&c.Code, &other.Code},
+		{&c.Link, &other.Link},
+		{&c.Sticker, &other.Sticker},
+		{&c.Emoji, &other.Emoji},
+		{&c.Command, &other.Command},
+	}
+	for _, f := range fields {
+		if *f.src != nil {
+			*f.dst = *f.src
+		}
+	}
+	if other.Authors != nil {
+		c.Authors = other.Authors
+	}
+	if other.ChatColors != nil {
+		c.ChatColors = other.ChatColors
+	}
+}
+
+func newTheme(name string, config themeConfig) (*Theme, error) {
+	t := &Theme{Name: name, ChatColors: config.ChatColors != nil && *config.ChatColors}
+
+	var errs []string
+	parse := func(key string, value *string) styleSpec {
+		if value == nil {
+			return defaultStyleSpec
+		}
+		spec, err := parseStyle(*value)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", key, err))
+		}
+		return spec
+	}
+
+	t.ViewFg, t.ViewBg = parse("view", config.View).gocuiAttributes()
+	t.FrameFg, t.FrameBg = parse("frame", config.Frame).gocuiAttributes()
+	t.ActiveFrameFg, _ = parse("active-frame", config.ActiveFrame).gocuiAttributes()
+	t.SelectionFg, t.SelectionBg = parse("selection", config.Selection).gocuiAttributes()
+
+	t.OwnMessage = parse("own-message", config.OwnMessage).attributes()
+	t.Message = parse("message", config.Message).attributes()
+	t.System = parse("system", config.System).attributes()
+	t.Quote = parse("quote", config.Quote).attributes()
+	t.Timestamp = parse("timestamp", config.Timestamp).attributes()
+	t.Error = parse("error", config.Error).attributes()
+	t.Warning = parse("warning", config.Warning).attributes()
+	t.Unread = parse("unread", config.Unread).attributes()
+	t.Disabled = parse("disabled", config.Disabled).attributes()
+	t.Highlight = parse("highlight", config.Highlight).attributes()
+	t.Mention = parse("mention", config.Mention).attributes()
+	t.Code = parse("code", config.Code).attributes()
+	t.Link = parse("link", config.Link).attributes()
+	t.Sticker = parse("sticker", config.Sticker).attributes()
+	t.Emoji = parse("emoji", config.Emoji).attributes()
+	t.Command = parse("command", config.Command).attributes()
+	for i := range config.Authors {
+		t.Authors = append(t.Authors, parse("authors", &config.Authors[i]).attributes())
+	}
+
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return t, nil
+}
+
+// AuthorStyle returns a style of messages' authors.
+// It's derived from the public key so it's the same across runs.
+func (t *Theme) AuthorStyle(publicKey string) []color.Attribute {
+	if len(t.Authors) == 0 {
+		return nil
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(publicKey))
+	return t.Authors[h.Sum32()%uint32(len(t.Authors))]
+}
+
+// ChatStyle returns a style of the chat based on its colour.
+func (t *Theme) ChatStyle(chat *protocol.Chat) []color.Attribute {
+	if !t.ChatColors {
+		return nil
+	}
+	idx, ok := hexToPaletteColor(chat.Color)
+	if !ok {
+		return nil
+	}
+	return []color.Attribute{38, 5, color.Attribute(idx)}
+}
+
+// hexToPaletteColor returns the closest colour
+// of the 256-colour palette cube for colours like "#887af9".
+func hexToPaletteColor(hex string) (int, bool) {
+	hex = strings.TrimPrefix(hex, "#")
+	if len(hex) != 6 {
+		return 0, false
+	}
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0, false
+	}
+	level := func(c uint64) int {
+		return int((c*5 + 127) / 255)
+	}
+	r, g, b := level(rgb>>16&0xff), level(rgb>>8&0xff), level(rgb&0xff)
+	return 16 + 36*r + 6*g + b, true
+}
+
+// styleSpec is a parsed style.
+// Colours are indexes of the 256-colour palette or -1 for default.
+type styleSpec struct {
+	fg, bg                   int
+	bold, underline, reverse bool
+}
+
+var defaultStyleSpec = styleSpec{fg: -1, bg: -1}
+
+var colorNames = map[string]int{
+	"black":   0,
+	"red":     1,
+	"green":   2,
+	"yellow":  3,
+	"blue":    4,
+	"magenta": 5,
+	"cyan":    6,
+	"white":   7,
+}
+
+// parseStyle parses styles like "bold yellow bg:black".
+func parseStyle(s string) (styleSpec, error) {
+	spec := defaultStyleSpec
+	for _, word := range strings.Fields(strings.ToLower(s)) {
+		switch word {
+		case "bold":
+			spec.bold = true
+		case "underline":
+			spec.underline = true
+		case "reverse":
+			spec.reverse = true
+		case "default":
+		default:
+			bg := strings.HasPrefix(word, "bg:")
+			c, err := parseColor(strings.TrimPrefix(word, "bg:"))
+			if err != nil {
+				return spec, err
+			}
+			if bg {
+				spec.bg = c
+			} else {
+				spec.fg = c
+			}
+		}
+	}
+	return spec, nil
+}
+
+func parseColor(s string) (int, error) {
+	if s == "default" {
+		return -1, nil
+	}
+	if c, ok := colorNames[s]; ok {
+		return c, nil
+	}
+	c, err := strconv.Atoi(s)
+	if err != nil || c < 0 || c > 255 {
+		return 0, fmt.Errorf("invalid colour %q", s)
+	}
+	return c, nil
+}
+
+// attributes returns SGR attributes of the style.
+func (s styleSpec) attributes() []color.Attribute {
+	var attrs []color.Attribute
+	switch {
+	case s.fg >= 0 && s.fg < 8:
+		attrs = append(attrs, color.FgBlack+color.Attribute(s.fg))
+	case s.fg >= 8:
+		attrs = append(attrs, 38, 5, color.Attribute(s.fg))
+	}
+	if s.bold {
+		attrs = append(attrs, color.Bold)
+	}
+	if s.underline {
+		attrs = append(attrs, color.Underline)
+	}
+	if s.reverse {
+		attrs = append(attrs, color.ReverseVideo)
+	}
+	switch {
+	case s.bg >= 0 && s.bg < 8:
+		attrs = append(attrs, color.BgBlack+color.Attribute(s.bg))
+	case s.bg >= 8:
+		attrs = append(attrs, 48, 5, color.Attribute(s.bg))
+	}
+	return attrs
+}
+
+// gocuiAttributes returns foreground and background
+// gocui attributes of the style.
+func (s styleSpec) gocuiAttributes() (fg, bg gocui.Attribute) {
+	fg, bg = gocui.ColorDefault, gocui.ColorDefault
+	if s.fg >= 0 {
+		fg = gocui.Attribute(s.fg + 1)
+	}
+	if s.bg >= 0 {
+		bg = gocui.Attribute(s.bg + 1)
+	}
+	if s.bold {
+		fg |= gocui.AttrBold
+	}
+	if s.underline {
+		fg |= gocui.AttrUnderline
+	}
+	if s.reverse {
+		fg |= gocui.AttrReverse
+	}
+	return fg, bg
+}
+
+// styled returns the text with the style applied.
+func styled(text string, style []color.Attribute) string {
+	if len(style) == 0 || color.NoColor {
+		return text
+	}
+	return sgr(style) + text + sgrReset
+}
+
+// span returns the text with the style applied
+// followed by the base style of the surrounding text.
+func span(text string, style, base []color.Attribute) string {
+	if len(style) == 0 || color.NoColor {
+		return text
+	}
+	return sgr(style) + text + sgrReset + sgr(base)
+}
@@ -11,10 +11,19 @@ import (
 
 // Type of views.
 const (
-	ViewChats        = "chats"
-	ViewChat         = "chat"
-	ViewInput        = "input"
-	ViewNotification = "notification"
+	ViewChats           = "chats"
+	ViewChat            = "chat"
+	ViewInput           = "input"
+	ViewNotification    = "notification"
+	ViewContacts        = "contacts"
+	ViewDevices         = "devices"
+	ViewMailservers     = "mailservers"
+	ViewToast           = "toast"
+	ViewCompletion      = "completion"
+	ViewHelp            = "help"
+	ViewStatusBar       = "status"
+	ViewSwitcher        = "switcher"
+	ViewSwitcherResults = "switcher-results"
 )
 
 // View describes a single terminal view.
@@ -30,6 +39,12 @@ type View struct {
 	Wrap                   bool
 	Highlight              bool
 	SelBgColor, SelFgColor gocui.Attribute
+	// Editor replaces the default editor of editable views.
+	Editor gocui.Editor
+	// Frameless views are drawn without a frame and a title.
+	Frameless bool
+	// Passive views only display information and are skipped by NextView.
+	Passive bool
 
 	Keybindings []Binding
 
@@ -43,14 +58,16 @@ type ViewManager struct {
 	views        []*View
 	activeView   string
 	previousView string
+	theme        *Theme
 	logger       *zap.Logger
 }
 
 // NewViewManager returns a new view manager.
-func NewViewManager(views []*View, g *gocui.Gui, logger *zap.Logger) *ViewManager {
+func NewViewManager(views []*View, g *gocui.Gui, theme *Theme, logger *zap.Logger) *ViewManager {
 	m := ViewManager{
 		g:      g,
 		views:  views,
+		theme:  theme,
 		logger: logger.With(zap.Namespace("ViewManager")),
 	}
 
@@ -61,7 +78,9 @@ func NewViewManager(views []*View, g *gocui.Gui, logger *zap.Logger) *ViewManage
 
 	m.g.Highlight = true
 	m.g.Cursor = true
-	m.g.SelFgColor = gocui.ColorGreen
+	m.g.FgColor = theme.FrameFg
+	m.g.BgColor = theme.FrameBg
+	m.g.SelFgColor = theme.ActiveFrameFg
 
 	m.g.SetManagerFunc(m.Layout)
 
@@ -106,6 +125,11 @@ func (m *ViewManager) SetGlobalKeybindings(bindings []Binding) error {
 	return nil
 }
 
+// Theme returns the theme of the views.
+func (m *ViewManager) Theme() *Theme {
+	return m.theme
+}
+
 // RawView returns a underlying low level view struct.
 func (m *ViewManager) RawView(name string) (*gocui.View, error) {
 	return m.g.View(name)
@@ -161,8 +185,14 @@ func (m *ViewManager) Layout(g *gocui.Gui) error {
 		}
 		v.Autoscroll = config.Autoscroll
 		v.Editable = config.Editable
+		if config.Editor != nil {
+			v.Editor = config.Editor
+		}
 		v.Wrap = config.Wrap
+		v.Frame = !config.Frameless
 		v.Highlight = config.Highlight
+		v.FgColor = m.theme.ViewFg
+		v.BgColor = m.theme.ViewBg
 		v.SelFgColor = config.SelFgColor
 		v.SelBgColor = config.SelBgColor
 
@@ -232,6 +262,54 @@ func (m *ViewManager) DisableView(name string) error {
 	return errors.Wrap(err, "failed to disable view")
 }
 
+// ShowView enables the view without selecting it.
+func (m *ViewManager) ShowView(name string) error {
+	view := m.ViewByName(name)
+	if view == nil {
+		return fmt.Errorf("failed to show non-existing view '%s'", name)
+	}
+	if view.Enabled {
+		return nil
+	}
+
+	view.Enabled = true
+
+	return errors.Wrap(m.Layout(m.g), fmt.Sprintf("failed to show view '%s'", name))
+}
+
+// HideView disables and deletes the view which was shown with ShowView.
+func (m *ViewManager) HideView(name string) error {
+	view := m.ViewByName(name)
+	if view == nil {
+		return fmt.Errorf("failed to hide non-existing view '%s'", name)
+	}
+	if !view.Enabled {
+		return nil
+	}
+
+	view.Enabled = false
+
+	return m.DeleteView(name)
+}
+
+// ToggleView enables a disabled view or disables
+// and deletes an enabled one.
+func (m *ViewManager) ToggleView(name string) error {
+	view := m.ViewByName(name)
+	if view == nil {
+		return fmt.Errorf("failed to toggle non-existing view '%s'", name)
+	}
+
+	if !view.Enabled {
+		return m.EnableView(name)
+	}
+
+	if err := m.DisableView(name); err != nil {
+		return err
+	}
+	return m.DeleteView(name)
+}
+
 // SelectView selects a view to be active by name.
 func (m *ViewManager) SelectView(name string) (*gocui.View, error) {
 	m.logger.Debug("selecting view", zap.String("name", name))
@@ -279,7 +357,7 @@ func (m *ViewManager) NextView() error {
 		nextActive = (nextActive + 1) % len(m.views)
 
 		nextView := m.views[nextActive]
-		if !nextView.Enabled {
+		if !nextView.Enabled || nextView.Passive {
 			continue
 		}
 